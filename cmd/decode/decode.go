@@ -1,54 +1,179 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
+	"github.com/cravtos/huffman/internal/pkg/crypt"
 	"github.com/cravtos/huffman/internal/pkg/helpers"
 	"github.com/cravtos/huffman/internal/pkg/huffman"
+	"github.com/cravtos/huffman/internal/pkg/progress"
+	"github.com/cravtos/huffman/internal/pkg/sign"
+	"github.com/cravtos/huffman/internal/pkg/volume"
 )
 
 func main() {
 	inPath := flag.String("input", "", "File to decode.")
 	outPath := flag.String("output", "", "Output file.")
 	printRatio := flag.Bool("pr", false, "Print compression ratio.")
+	maxOutput := flag.Int64("max-output", 0, "Maximum size of decoded data in bytes, 0 means no limit.")
+	keyFile := flag.String("key-file", "", "File holding raw 32 byte key of encrypted file.")
+	pubPath := flag.String("pub", "", "Refuse to decode file not signed by this public key.")
+	sigPath := flag.String("sig", "", "Detached signature checked with -pub, defaults to input.sig if input has no signature trailer.")
+	passFile := flag.String("pass-file", "", "File holding passphrase of encrypted file, $"+crypt.PassphraseEnv+" is used by default.")
+	force := flag.Bool("f", false, "Overwrite existing output.")
+	restore := flag.Bool("N", false, "Restore original name, mode and times stored by encode -meta. Output defaults to original name next to input.")
+	owner := flag.Bool("owner", false, "With -N, restore owner stored by encode -owner as well.")
+	xattrs := flag.Bool("xattrs", false, "With -N, restore extended attributes stored by encode -xattrs as well.")
+	special := flag.Bool("special", false, "With -N, restore setuid, setgid and sticky bits as well.")
 
 	flag.Parse()
 
 	// Check if file is specified as argument
-	if *inPath == "" || *outPath == "" {
+	if *inPath == "" || *outPath == "" && !*restore {
 		fmt.Fprintln(os.Stderr, "specify both input and output files path!")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// Open file to read data
-	inFile, err := os.Open(*inPath)
+	secret, err := crypt.LoadSecret(*keyFile, *passFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "can't open file %s\n", *inPath)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	defer inFile.Close()
 
-	// Open file to write decompressed data
-	outFile, err := os.Create(*outPath)
+	volumes := isVolume(*inPath)
+	if *pubPath != "" && volumes {
+		fmt.Fprintln(os.Stderr, "signatures of volumes are not supported")
+		os.Exit(1)
+	}
+
+	// Open file or set of volumes to read data
+	var in io.Reader
+	var inFile *os.File
+	var inSize int64
+	if volumes {
+		vr, err := volume.Open(*inPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer vr.Close()
+		in, inSize = vr, vr.Size()
+	} else {
+		if inFile, err = os.Open(*inPath); err != nil {
+			fmt.Fprintf(os.Stderr, "can't open file %s\n", *inPath)
+			os.Exit(1)
+		}
+		defer inFile.Close()
+		in = inFile
+
+		// Check signature before anything is decoded, on the same file
+		// which is decoded, so it can not be replaced in between
+		if *pubPath != "" {
+			pub, err := sign.ReadPublicKey(*pubPath)
+			if err == nil {
+				err = sign.VerifyOpenFile(inFile, *sigPath, pub)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Show progress when stderr is a terminal
+	opts := huffman.DecodeOptions{MaxOutput: *maxOutput, Secret: secret}
+	var bar *progress.Bar
+	if progress.IsTerminal(os.Stderr) {
+		bar = progress.New(os.Stderr, "decoding")
+		opts.Progress = bar.Update
+	}
+
+	corrected := 0
+	opts.Corrected = func(n int) { corrected = n }
+
+	r, err := huffman.NewReaderWith(in, opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "can't create file %s\n", *outPath)
+		fmt.Fprintf(os.Stderr, "got error while decoding: %v\n", err)
 		os.Exit(1)
 	}
-	defer outFile.Close()
 
-	err = huffman.Decode(inFile, outFile)
+	// Original name is known once stream header is read
+	meta := r.Metadata()
+	if *restore && *outPath == "" {
+		if meta == nil || meta.Name == "" {
+			fmt.Fprintf(os.Stderr, "%s has no original name, specify output file path\n", *inPath)
+			os.Exit(1)
+		}
+		*outPath = filepath.Join(filepath.Dir(*inPath), meta.Name)
+	}
+
+	// Decompressed data is written to temporary file renamed to output
+	// only when all data is decoded, so nothing partial is left
+	output, err := helpers.CreateOutput(*outPath, *force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't create file %s: %v\n", *outPath, err)
+		os.Exit(1)
+	}
+	defer output.Close()
+	outFile := output.File
+
+	err = r.DecodeTo(context.Background(), output)
+	if err == nil && *restore && meta != nil {
+		if err = meta.Apply(output.File.Name(), *owner, *xattrs, *special); err != nil {
+			err = fmt.Errorf("can't restore metadata: %v", err)
+		}
+	}
+	if err == nil {
+		err = output.Commit()
+	} else {
+		output.Abort()
+	}
+	if bar != nil {
+		bar.Finish()
+	}
+	if corrected > 0 {
+		fmt.Fprintf(os.Stderr, "corrected %d damaged bytes\n", corrected)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "got error while decoding: %v\n", err)
 		os.Exit(1)
 	}
 
-	if *printRatio == true {
+	if *printRatio == true && volumes {
+		stat, err := outFile.Stat()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "got error while getting compression ratio: %v\n", err)
+			os.Exit(2)
+		}
+		helpers.PrintSizeRatio(inSize, stat.Size())
+	} else if *printRatio == true {
 		if err := helpers.PrintRatio(inFile, outFile); err != nil {
 			fmt.Fprintf(os.Stderr, "got error while getting compression ratio: %v\n", err)
 			os.Exit(2)
 		}
 	}
 }
+
+// isVolume reports whether named file is a volume of a set.
+func isVolume(name string) bool {
+	if _, ok := volume.BaseName(name); !ok {
+		return false
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, len(volume.Magic))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return volume.Detect(head)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// ext is the extension of encoded files written in batch mode.
+const ext = ".huf"
+
+// Exit codes of batch mode.
+const (
+	exitFailed  = 1 // No file was encoded
+	exitPartial = 2 // Some files were not encoded
+)
+
+// batch configures encoding of many files.
+type batch struct {
+	opts      huffman.Options
+	recursive bool   // Encode files in directories
+	outDir    string // Directory mirroring encoded files, empty means alongside originals
+	jobs      int    // Number of files encoded in parallel
+	force     bool   // Overwrite existing outputs
+	meta      bool   // Store metadata of every file
+	owner     bool
+	xattrs    bool
+}
+
+// job is a file to encode and the result of encoding.
+type job struct {
+	in, out string
+	inSize  int64
+	outSize int64
+	skipped string // Reason to skip file, empty if it is encoded
+	err     error
+}
+
+// run encodes every file found in paths, prints summary table and
+// returns exit code.
+func (b batch) run(paths []string) int {
+	jobs := b.collect(paths)
+
+	queue := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < b.jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				j.inSize, j.outSize, j.err = b.encode(j.in, j.out)
+			}
+		}()
+	}
+	for _, j := range jobs {
+		if j.err == nil && j.skipped == "" {
+			queue <- j
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return summary(os.Stdout, jobs)
+}
+
+// collect returns jobs of files found in paths. Paths are expanded
+// if they are globs, and directories are walked if recursive is set.
+func (b batch) collect(paths []string) []*job {
+	var jobs []*job
+	outputs := make(map[string]bool)
+
+	add := func(root, name string, err error) {
+		j := &job{in: name, err: err}
+		jobs = append(jobs, j)
+		if err != nil {
+			return
+		}
+		if strings.HasSuffix(name, ext) {
+			j.skipped = "already has " + ext + " suffix"
+			return
+		}
+
+		j.out = name + ext
+		if b.outDir != "" {
+			// Path is kept relative to the parent of given path
+			rel, err := filepath.Rel(filepath.Dir(root), name)
+			if err != nil {
+				j.err = err
+				return
+			}
+			j.out = filepath.Join(b.outDir, rel) + ext
+		}
+		if outputs[j.out] {
+			j.err = fmt.Errorf("output %s is written by another file", j.out)
+		}
+		outputs[j.out] = true
+	}
+
+	for _, p := range paths {
+		matches := []string{p}
+		if strings.ContainsAny(p, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(p); err != nil || len(matches) == 0 {
+				add(p, p, errors.New("no files match"))
+				continue
+			}
+		}
+
+		for _, root := range matches {
+			root = filepath.Clean(root)
+			info, err := os.Stat(root)
+			switch {
+			case err != nil:
+				add(root, root, err)
+			case info.IsDir() && !b.recursive:
+				add(root, root, errors.New("is a directory, use -r to encode files in it"))
+			case info.IsDir():
+				err = filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+					if err != nil {
+						add(root, name, err)
+						return nil
+					}
+					if info.Mode().IsRegular() {
+						add(root, name, nil)
+					}
+					return nil
+				})
+				if err != nil {
+					add(root, root, err)
+				}
+			case !info.Mode().IsRegular():
+				add(root, root, errors.New("is not a regular file"))
+			default:
+				add(root, root, nil)
+			}
+		}
+	}
+	return jobs
+}
+
+// encode encodes named file to output and returns sizes of both.
+func (b batch) encode(in, out string) (inSize, outSize int64, err error) {
+	opts := b.opts
+	if b.meta || b.owner || b.xattrs {
+		if opts.Metadata, err = huffman.FileMetadata(in, b.owner, b.xattrs); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	inFile, err := os.Open(in)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer inFile.Close()
+
+	if err = os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+		return 0, 0, err
+	}
+	output, err := helpers.CreateOutput(out, b.force)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer output.Close()
+
+	err = huffman.EncodeContext(context.Background(), inFile, output, opts)
+	if err == nil {
+		err = output.Commit()
+	} else {
+		output.Abort()
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	inStat, err := inFile.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	outStat, err := output.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	return inStat.Size(), outStat.Size(), nil
+}
+
+// summary prints table of encoded files and returns exit code.
+func summary(w io.Writer, jobs []*job) int {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "file\tinput size\toutput size\tratio\tstatus")
+
+	var inTotal, outTotal int64
+	var encoded, failed, skipped int
+	for _, j := range jobs {
+		switch {
+		case j.err != nil:
+			failed++
+			fmt.Fprintf(tw, "%s\t-\t-\t-\tfailed: %v\n", j.in, j.err)
+		case j.skipped != "":
+			skipped++
+			fmt.Fprintf(tw, "%s\t-\t-\t-\tskipped: %s\n", j.in, j.skipped)
+		default:
+			encoded++
+			inTotal += j.inSize
+			outTotal += j.outSize
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%.3f\tok\n", j.in, j.inSize, j.outSize, ratio(j.inSize, j.outSize))
+		}
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%.3f\t%d encoded, %d skipped, %d failed\n",
+		inTotal, outTotal, ratio(inTotal, outTotal), encoded, skipped, failed)
+	tw.Flush()
+
+	switch {
+	case failed > 0 && encoded == 0:
+		return exitFailed
+	case failed > 0:
+		return exitPartial
+	}
+	return 0
+}
+
+// ratio returns compression ratio.
+func ratio(inSize, outSize int64) float32 {
+	if outSize == 0 {
+		return 0
+	}
+	return float32(inSize) / float32(outSize)
+}
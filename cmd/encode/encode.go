@@ -1,27 +1,182 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 
+	"github.com/cravtos/huffman/internal/pkg/crypt"
+	"github.com/cravtos/huffman/internal/pkg/filter"
 	"github.com/cravtos/huffman/internal/pkg/helpers"
 	"github.com/cravtos/huffman/internal/pkg/huffman"
+	"github.com/cravtos/huffman/internal/pkg/progress"
+	"github.com/cravtos/huffman/internal/pkg/volume"
 )
 
 func main() {
 	inPath := flag.String("input", "", "File to encode.")
 	outPath := flag.String("output", "", "Output file.")
 	printRatio := flag.Bool("pr", false, "Print compression ratio.")
+	method := flag.String("method", "huffman", "Encoding method: huffman, interleaved, arith or rans.")
+	filters := flag.String("filter", "none", "Comma separated filters: none, delta, stride:N, xor:N, bcj or auto.")
+	blockSize := flag.Int("block-size", huffman.DefaultBlockSize, "Amount of data coded in one block.")
+	runs := flag.String("rle", "auto", "Collapse runs of repeated symbols: auto, on or off.")
+	words := flag.Bool("words", false, "Code words and separators instead of bytes.")
+	width := flag.Uint("width", 0, "Code samples of 8, 16 or 32 bits instead of bytes.")
+	bigEndian := flag.Bool("be", false, "Samples are big endian.")
+	predictor := flag.String("predictor", "none", "Sample predictor: none, delta or linear.")
+	escape := flag.Int("escape", 0, "Maximum number of distinct sample symbols, rarer ones are escaped.")
+	maxCodeLen := flag.Int("max-code-len", huffman.DefaultMaxCodeLen, "Maximum length of Huffman code in bits.")
+	header := flag.String("header", "tree", "How Huffman codes are stored: tree or canonical.")
+	checksum := flag.String("checksum", "crc32", "Checksum of every block: crc32, crc64 or none.")
+	concurrency := flag.Int("concurrency", 0, "Number of blocks encoded in parallel, 0 means number of CPUs. In batch mode defaults to 1, as files are encoded in parallel by -j.")
+	parity := flag.Int("parity", 0, "Redundancy of Reed-Solomon parity in percents, e.g. 5, 10 or 20. 0 means no parity.")
+	encrypt := flag.Bool("encrypt", false, "Encrypt with passphrase from -pass-file or $"+crypt.PassphraseEnv+", or with -key-file.")
+	keyFile := flag.String("key-file", "", "File holding raw 32 byte encryption key.")
+	passFile := flag.String("pass-file", "", "File holding encryption passphrase.")
+	sync := flag.Bool("sync", false, "Precede every block with sync marker, so damaged file can be recovered.")
+	meta := flag.Bool("meta", false, "Store name, mode and modification time of input, restored by decode -N.")
+	owner := flag.Bool("owner", false, "Store owner of input as well, implies -meta.")
+	xattrs := flag.Bool("xattrs", false, "Store extended attributes of input as well, implies -meta.")
+	force := flag.Bool("f", false, "Overwrite existing output.")
+	appendTo := flag.Bool("append", false, "Append new stream to existing output, so it is decoded after data already there.")
+	volumeSize := flag.String("volume-size", "", "Split output into volumes output.001, output.002 and so on of this size, e.g. 25M or 100Mi.")
+	recursive := flag.Bool("r", false, "Encode files in directories given as paths.")
+	outDir := flag.String("outdir", "", "Write name.huf of every path to this directory instead of alongside it.")
+	jobs := flag.Int("j", runtime.NumCPU(), "Number of files encoded in parallel.")
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -input file -output file [flags]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] [-r] [-outdir dir] [-j n] paths...\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Paths may be globs. Every file is encoded to name.huf, and a summary is printed.")
+		fmt.Fprintln(flag.CommandLine.Output(), "Exit status is 1 if no file was encoded and 2 if some files failed.")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	// Check if file is specified as argument
-	if *inPath == "" || *outPath == "" {
+	batchMode := flag.NArg() > 0
+	if batchMode && (*inPath != "" || *outPath != "") {
+		fmt.Fprintln(os.Stderr, "specify either input and output files path or paths to encode!")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if !batchMode && (*inPath == "" || *outPath == "") {
 		fmt.Fprintln(os.Stderr, "specify both input and output files path!")
 		flag.Usage()
 		os.Exit(1)
 	}
+	if batchMode && (*appendTo || *volumeSize != "") {
+		fmt.Fprintln(os.Stderr, "-append and -volume-size can not be used with paths")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *jobs < 1 {
+		fmt.Fprintln(os.Stderr, "-j must be at least 1")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	opts := huffman.Options{
+		Words:       *words,
+		Width:       uint8(*width),
+		BigEndian:   *bigEndian,
+		Escape:      *escape,
+		BlockSize:   *blockSize,
+		MaxCodeLen:  *maxCodeLen,
+		Concurrency: *concurrency,
+		Sync:        *sync,
+		Parity:      *parity,
+	}
+	var err error
+	if opts.Method, err = huffman.ParseMethod(*method); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if opts.Predictor, err = huffman.ParsePredictor(*predictor); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if opts.Runs, err = huffman.ParseRunMode(*runs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if opts.Filters, err = filter.ParseList(*filters); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if opts.Header, err = huffman.ParseHeaderFormat(*header); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if opts.Checksum, err = huffman.ParseChecksum(*checksum); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *encrypt {
+		if opts.Secret, err = crypt.LoadSecret(*keyFile, *passFile); err == nil && opts.Secret.IsZero() {
+			err = fmt.Errorf("specify -key-file, -pass-file or $%s to encrypt", crypt.PassphraseEnv)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if (*meta || *owner || *xattrs) && !batchMode {
+		if opts.Metadata, err = huffman.FileMetadata(*inPath, *owner, *xattrs); err != nil {
+			fmt.Fprintf(os.Stderr, "can't read metadata of %s: %v\n", *inPath, err)
+			os.Exit(1)
+		}
+	}
+	var maxVolume int64
+	if *volumeSize != "" && *appendTo {
+		fmt.Fprintln(os.Stderr, "-append can not be used with -volume-size")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *volumeSize != "" {
+		if maxVolume, err = volume.ParseSize(*volumeSize); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+	if err = opts.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if batchMode {
+		// Files are already encoded in parallel, so every file uses
+		// one block encoder unless asked otherwise
+		explicit := false
+		flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "concurrency" })
+		if !explicit {
+			opts.Concurrency = 1
+		}
+
+		b := batch{
+			opts:      opts,
+			recursive: *recursive,
+			outDir:    *outDir,
+			jobs:      *jobs,
+			force:     *force,
+			meta:      *meta,
+			owner:     *owner,
+			xattrs:    *xattrs,
+		}
+		os.Exit(b.run(flag.Args()))
+	}
 
 	// Open file to read data
 	inFile, err := os.Open(*inPath)
@@ -31,24 +186,126 @@ func main() {
 	}
 	defer inFile.Close()
 
-	// Open file to write compressed data
-	outFile, err := os.Create(*outPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "can't create file %s\n", *outPath)
-		os.Exit(1)
+	// Open file or volumes to write compressed data. Data is written to
+	// temporary files renamed to output or volumes only on success, and
+	// appended data is removed on failure, so nothing partial is left
+	var out io.Writer
+	var outFile *os.File
+	var output *helpers.Output
+	var volumes *volume.Writer
+	var appended int64 // Size of output before appending
+	var undoAppend func()
+	if maxVolume > 0 {
+		if volumes, err = volume.Create(*outPath, maxVolume, *force); err != nil {
+			fmt.Fprintf(os.Stderr, "can't create volumes %s: %v\n", *outPath, err)
+			os.Exit(1)
+		}
+		out = volumes
+	} else if *appendTo {
+		var created bool
+		if outFile, appended, created, err = openAppend(*outPath); err != nil {
+			fmt.Fprintf(os.Stderr, "can't append to file %s: %v\n", *outPath, err)
+			os.Exit(1)
+		}
+		defer outFile.Close()
+
+		// File created for appending is removed, existing one is truncated
+		undoAppend = func() { outFile.Truncate(appended) }
+		if created {
+			undoAppend = func() { os.Remove(*outPath) }
+		}
+		defer helpers.OnInterrupt(undoAppend)()
+		out = outFile
+	} else {
+		if output, err = helpers.CreateOutput(*outPath, *force); err != nil {
+			fmt.Fprintf(os.Stderr, "can't create file %s: %v\n", *outPath, err)
+			os.Exit(1)
+		}
+		defer output.Close()
+		outFile, out = output.File, output
+	}
+
+	// Show progress when stderr is a terminal
+	var bar *progress.Bar
+	if progress.IsTerminal(os.Stderr) {
+		bar = progress.New(os.Stderr, "encoding")
+		opts.Progress = bar.Update
 	}
-	defer outFile.Close()
 
-	err = huffman.Encode(inFile, outFile)
+	err = huffman.EncodeContext(context.Background(), inFile, out, opts)
+	if bar != nil {
+		bar.Finish()
+	}
+	if volumes != nil {
+		if cerr := volumes.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if output != nil && err == nil {
+		err = output.Commit()
+	}
 	if err != nil {
+		switch {
+		case volumes != nil:
+			volumes.Abort()
+		case *appendTo:
+			// Do not leave incomplete member after data already there
+			undoAppend()
+		default:
+			output.Abort()
+		}
 		fmt.Fprintf(os.Stderr, "got error while encoding: %v\n", err)
 		os.Exit(1)
 	}
 
-	if *printRatio == true {
+	if *printRatio == true && volumes != nil {
+		stat, err := inFile.Stat()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "got error while getting compression ratio: %v\n", err)
+			os.Exit(2)
+		}
+		helpers.PrintSizeRatio(stat.Size(), volumes.Size())
+		fmt.Printf("volumes: %v\n", volumes.Count())
+	} else if *printRatio == true && *appendTo {
+		inStat, err := inFile.Stat()
+		if err == nil {
+			var outStat os.FileInfo
+			if outStat, err = outFile.Stat(); err == nil {
+				helpers.PrintSizeRatio(inStat.Size(), outStat.Size()-appended)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "got error while getting compression ratio: %v\n", err)
+			os.Exit(2)
+		}
+	} else if *printRatio == true {
 		if err := helpers.PrintRatio(inFile, outFile); err != nil {
 			fmt.Fprintf(os.Stderr, "got error while getting compression ratio: %v\n", err)
 			os.Exit(2)
 		}
 	}
 }
+
+// openAppend opens named file to append new stream to it, creating it if needed.
+// Returns the file, its size and whether it was created. Existing file is
+// checked before anything is created, so rejected output is left as it was.
+func openAppend(name string) (*os.File, int64, bool, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		f, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		return f, 0, err == nil, err
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err == nil {
+		err = huffman.CanAppend(f, size)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, false, err
+	}
+	return f, size, false, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cravtos/huffman/internal/pkg/archive"
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// pack writes archive of a directory.
+func pack(args []string) error {
+	flags := flag.NewFlagSet("pack", flag.ExitOnError)
+	method := flags.String("method", "huffman", "Encoding method: huffman, interleaved, arith or rans.")
+	force := flags.Bool("f", false, "Overwrite existing archive.")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("specify directory and archive path")
+	}
+
+	var opts huffman.Options
+	var err error
+	if opts.Method, err = huffman.ParseMethod(*method); err != nil {
+		return err
+	}
+
+	// Archive is written to temporary file renamed to archive path when it is complete
+	out, err := helpers.CreateOutput(flags.Arg(1), *force)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err = archive.Pack(out, flags.Arg(0), opts); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Commit()
+}
+
+// openArchive opens archive and reads its directory.
+func openArchive(name string) (*os.File, *archive.Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	ar, err := archive.NewReader(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, ar, nil
+}
+
+// unpack extracts all or selected entries of archive.
+func unpack(args []string) error {
+	flags := flag.NewFlagSet("unpack", flag.ExitOnError)
+	dir := flags.String("o", ".", "Directory to extract to.")
+	stdout := flags.Bool("c", false, "Write selected files to standard output.")
+	special := flags.Bool("special", false, "Restore setuid, setgid and sticky bits as well.")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("specify archive path")
+	}
+
+	f, ar, err := openArchive(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !*stdout {
+		return ar.Extract(*dir, flags.Args()[1:], *special)
+	}
+
+	for _, p := range flags.Args()[1:] {
+		e := ar.Find(p)
+		if e == nil {
+			return fmt.Errorf("%s: not found in archive", p)
+		}
+		if err := ar.Decode(e, os.Stdout); err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// list prints entries of archive.
+func list(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("specify archive path")
+	}
+
+	f, ar, err := openArchive(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	types := map[archive.Type]string{archive.File: "-", archive.Dir: "d", archive.Symlink: "l"}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, e := range ar.Entries {
+		name := e.Path
+		if e.Type == archive.Symlink {
+			name += " -> " + e.Link
+		}
+		fmt.Fprintf(tw, "%s%s\t%d\t%d\t%s\t%s\n", types[e.Type], e.Mode.Perm().String()[1:], e.Size, e.CompressedSize(),
+			e.ModTime.Format("2006-01-02 15:04"), name)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cravtos/huffman/internal/pkg/corpus"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// codec is a compressor measured by bench.
+type codec struct {
+	name   string
+	encode func(w io.Writer, data []byte) error
+	decode func(r io.Reader) io.Reader
+}
+
+// codecs returns modes of this project followed by compressors of standard library.
+func codecs() []codec {
+	var list []codec
+	for _, words := range []bool{false, true} {
+		for _, method := range huffman.Methods() {
+			name := method.String()
+			if words {
+				name += "/words"
+			}
+			opts := huffman.Options{Method: method, Words: words}
+			list = append(list, codec{
+				name: name,
+				encode: func(w io.Writer, data []byte) error {
+					return huffman.EncodeWith(bytes.NewReader(data), w, opts)
+				},
+				decode: func(r io.Reader) io.Reader {
+					hr, err := huffman.NewReader(r)
+					if err != nil {
+						return errReader{err}
+					}
+					return hr
+				},
+			})
+		}
+	}
+
+	flateCodec := func(name string, level int) codec {
+		return codec{
+			name:   name,
+			encode: writerEncoder(func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, level) }),
+			decode: func(r io.Reader) io.Reader { return flate.NewReader(r) },
+		}
+	}
+	return append(list,
+		flateCodec("flate", flate.DefaultCompression),
+		flateCodec("flate/speed", flate.BestSpeed),
+		flateCodec("flate/huffman-only", flate.HuffmanOnly),
+		codec{
+			name:   "gzip",
+			encode: writerEncoder(func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }),
+			decode: func(r io.Reader) io.Reader {
+				zr, err := gzip.NewReader(r)
+				if err != nil {
+					return errReader{err}
+				}
+				return zr
+			},
+		},
+		codec{
+			name:   "zlib",
+			encode: writerEncoder(func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriter(w), nil }),
+			decode: func(r io.Reader) io.Reader {
+				zr, err := zlib.NewReader(r)
+				if err != nil {
+					return errReader{err}
+				}
+				return zr
+			},
+		},
+		codec{
+			name:   "lzw",
+			encode: writerEncoder(func(w io.Writer) (io.WriteCloser, error) { return lzw.NewWriter(w, lzw.LSB, 8), nil }),
+			decode: func(r io.Reader) io.Reader { return lzw.NewReader(r, lzw.LSB, 8) },
+		},
+	)
+}
+
+// writerEncoder returns encode function of compressor created by newWriter.
+func writerEncoder(newWriter func(w io.Writer) (io.WriteCloser, error)) func(w io.Writer, data []byte) error {
+	return func(w io.Writer, data []byte) error {
+		cw, err := newWriter(w)
+		if err != nil {
+			return err
+		}
+		if _, err = cw.Write(data); err != nil {
+			return err
+		}
+		return cw.Close()
+	}
+}
+
+// errReader fails every read with err.
+type errReader struct{ err error }
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// input is data measured by bench.
+type input struct {
+	name string
+	data []byte
+}
+
+// result is a measurement of codec on input.
+type result struct {
+	input, codec string
+	size         int     // Size of input
+	encoded      int     // Size of encoded input
+	encSpeed     float64 // Encoding throughput in MB/s of input
+	decSpeed     float64 // Decoding throughput in MB/s of input
+	encAllocs    uint64  // Allocations per encoding
+	decAllocs    uint64  // Allocations per decoding
+	err          error
+}
+
+// bench measures throughput, ratio and allocations of every codec
+// on given files and synthetic data.
+func bench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	kinds := flags.String("corpus", "", "Comma separated synthetic data: uniform, zipf, geometric, markov, random, all or none. Defaults to all without files.")
+	size := flags.Int("size", 1<<20, "Size of every synthetic input in bytes.")
+	seed := flags.Int64("seed", 1, "Seed of synthetic data.")
+	only := flags.String("codecs", "", "Comma separated codecs to measure, all by default.")
+	minTime := flags.Duration("time", 200*time.Millisecond, "Minimum time of every measurement.")
+	asCSV := flags.Bool("csv", false, "Print CSV instead of table.")
+	flags.Parse(args)
+
+	if *size < 0 {
+		return errors.New("size must not be negative")
+	}
+	if *kinds == "" && flags.NArg() == 0 {
+		*kinds = "all"
+	}
+	ks, err := corpus.ParseKinds(*kinds)
+	if err != nil {
+		return err
+	}
+
+	var inputs []input
+	for _, name := range flags.Args() {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, input{filepath.Base(name), data})
+	}
+	for _, k := range ks {
+		data, err := corpus.Generate(k, *size, *seed)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, input{string(k), data})
+	}
+
+	list, err := selectCodecs(*only)
+	if err != nil {
+		return err
+	}
+
+	var results []result
+	for _, in := range inputs {
+		for _, c := range list {
+			results = append(results, measure(c, in, *minTime))
+		}
+	}
+
+	if *asCSV {
+		return printCSV(os.Stdout, results)
+	}
+	return printTable(os.Stdout, results)
+}
+
+// selectCodecs returns codecs named in comma separated list, or all of them if it is empty.
+func selectCodecs(names string) ([]codec, error) {
+	all := codecs()
+	if names == "" {
+		return all, nil
+	}
+
+	var list []codec
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for _, c := range all {
+			if c.name == strings.TrimSpace(name) {
+				list, found = append(list, c), true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown codec %q", name)
+		}
+	}
+	return list, nil
+}
+
+// measure encodes and decodes input repeatedly for at least minTime each,
+// and checks that decoded data matches input.
+func measure(c codec, in input, minTime time.Duration) result {
+	res := result{input: in.name, codec: c.name, size: len(in.data)}
+
+	var enc bytes.Buffer
+	encode := func() error {
+		enc.Reset()
+		return c.encode(&enc, in.data)
+	}
+	if err := encode(); err != nil {
+		res.err = err
+		return res
+	}
+	res.encoded = enc.Len()
+	encoded := append([]byte(nil), enc.Bytes()...)
+
+	dec := bytes.NewBuffer(make([]byte, 0, len(in.data)))
+	decode := func() error {
+		dec.Reset()
+		_, err := io.Copy(dec, c.decode(bytes.NewReader(encoded)))
+		return err
+	}
+	if err := decode(); err != nil {
+		res.err = err
+		return res
+	}
+	if !bytes.Equal(dec.Bytes(), in.data) {
+		res.err = errors.New("decoded data does not match input")
+		return res
+	}
+
+	var err error
+	if res.encSpeed, res.encAllocs, err = run(encode, len(in.data), minTime); err != nil {
+		res.err = err
+		return res
+	}
+	res.decSpeed, res.decAllocs, res.err = run(decode, len(in.data), minTime)
+	return res
+}
+
+// run calls fn until minTime passes and returns throughput in MB/s
+// of size bytes processed by every call, and allocations per call.
+func run(fn func() error, size int, minTime time.Duration) (float64, uint64, error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	n := 0
+	start := time.Now()
+	for n == 0 || time.Since(start) < minTime {
+		if err := fn(); err != nil {
+			return 0, 0, err
+		}
+		n++
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	speed := float64(size) * float64(n) / elapsed.Seconds() / 1e6
+	return speed, (after.Mallocs - before.Mallocs) / uint64(n), nil
+}
+
+// ratio returns compression ratio of result.
+func (res result) ratio() float64 {
+	if res.encoded == 0 {
+		return 0
+	}
+	return float64(res.size) / float64(res.encoded)
+}
+
+// printTable prints results as a table.
+func printTable(w io.Writer, results []result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "input\tcodec\tsize\tencoded\tratio\tencode MB/s\tdecode MB/s\tencode allocs\tdecode allocs\t")
+	for _, res := range results {
+		if res.err != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t-\t-\t-\t-\t-\t-\t%v\n", res.input, res.codec, res.size, res.err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.3f\t%.1f\t%.1f\t%d\t%d\t\n", res.input, res.codec, res.size,
+			res.encoded, res.ratio(), res.encSpeed, res.decSpeed, res.encAllocs, res.decAllocs)
+	}
+	return tw.Flush()
+}
+
+// printCSV prints results as CSV.
+func printCSV(w io.Writer, results []result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"input", "codec", "size", "encoded", "ratio", "encode_mbps", "decode_mbps", "encode_allocs", "decode_allocs", "error"})
+	for _, res := range results {
+		record := []string{res.input, res.codec, strconv.Itoa(res.size), "", "", "", "", "", "", ""}
+		if res.err != nil {
+			record[9] = res.err.Error()
+		} else {
+			record[3] = strconv.Itoa(res.encoded)
+			record[4] = strconv.FormatFloat(res.ratio(), 'f', 4, 64)
+			record[5] = strconv.FormatFloat(res.encSpeed, 'f', 2, 64)
+			record[6] = strconv.FormatFloat(res.decSpeed, 'f', 2, 64)
+			record[7] = strconv.FormatUint(res.encAllocs, 10)
+			record[8] = strconv.FormatUint(res.decAllocs, 10)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// compare encodes file with every method and reports achieved bits per input byte.
+// Encoded size includes the whole container: stream header, code tables, index,
+// footer and checksums, so on small inputs it is well above entropy.
+func compare(args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	inPath := flags.String("input", "", "File to compare methods on.")
+	flags.Parse(args)
+
+	if *inPath == "" && flags.NArg() == 1 {
+		*inPath = flags.Arg(0)
+	}
+	if *inPath == "" {
+		flags.Usage()
+		return errors.New("specify input file path")
+	}
+
+	data, err := ioutil.ReadFile(*inPath)
+	if err != nil {
+		return err
+	}
+
+	freq := helpers.CalcFreq(bytes.NewReader(data))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "method\tsize\tcontainer bits/byte\n")
+	fmt.Fprintf(tw, "entropy\t-\t%.4f\n", helpers.Entropy(freq))
+
+	for _, words := range []bool{false, true} {
+		for _, method := range huffman.Methods() {
+			name := method.String()
+			if words {
+				name += "/words"
+			}
+
+			var buf bytes.Buffer
+			opts := huffman.Options{Method: method, Words: words}
+			if err := huffman.EncodeWith(bytes.NewReader(data), &buf, opts); err != nil {
+				fmt.Fprintf(tw, "%s\t-\t%v\n", name, err)
+				continue
+			}
+
+			bps := 0.0
+			if len(data) > 0 {
+				bps = float64(buf.Len()*8) / float64(len(data))
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%.4f\n", name, buf.Len(), bps)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of huffman tool.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"compare", "compare [-input] file: show bits per input byte of file encoded by every method", compare},
+	{"pack", "pack [-method m] dir out.hfa: archive directory", pack},
+	{"unpack", "unpack [-o dir] [-c] archive.hfa [path...]: extract all or selected files", unpack},
+	{"list", "list archive.hfa: list archive entries", list},
+	{"keygen", "keygen [-o name]: generate Ed25519 key pair name.key and name.pub", keygen},
+	{"sign", "sign -key name.key [-detached] file.huf: sign file", signFile},
+	{"verify-sig", "verify-sig -pub name.pub [-sig file.sig] file.huf: check signature of file", verifySig},
+	{"recover", "recover [-o out] file.huf: decode intact blocks of damaged file", recoverFile},
+	{"bench", "bench [-corpus kinds] [-size n] [-codecs list] [-csv] [file...]: measure speed, ratio and allocations of codecs", bench},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	name, args := os.Args[1], os.Args[2:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		if err := cmd.run(args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	usage()
+	os.Exit(1)
+}
+
+// usage prints list of commands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: huffman <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "\t%s\n", cmd.usage)
+	}
+}
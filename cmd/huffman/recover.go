@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// recoverFile decodes intact blocks of damaged file and reports lost ranges.
+func recoverFile(args []string) error {
+	flags := flag.NewFlagSet("recover", flag.ExitOnError)
+	outPath := flags.String("o", "", "Output file, defaults to input without .huf extension.")
+	force := flags.Bool("f", false, "Overwrite existing output.")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("specify encoded file path")
+	}
+
+	name := flags.Arg(0)
+	if *outPath == "" {
+		*outPath = strings.TrimSuffix(name, ".huf")
+		if *outPath == name {
+			*outPath += ".recovered"
+		}
+	}
+
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Recovered data is written to temporary file renamed to output when recovery is over,
+	// so output is left as it was on failure or interrupt
+	out, err := helpers.CreateOutput(*outPath, *force)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	rep, err := huffman.Recover(in, stat.Size(), out)
+	if err != nil {
+		out.Abort()
+		return err
+	}
+	if err = out.Commit(); err != nil {
+		return err
+	}
+
+	if rep.Corrected > 0 {
+		fmt.Fprintf(os.Stderr, "corrected %d damaged bytes\n", rep.Corrected)
+	}
+	for _, r := range rep.Damaged {
+		fmt.Fprintf(os.Stderr, "damaged: bytes %d-%d (%d bytes), written as zeros\n", r.Offset, r.Offset+r.Size-1, r.Size)
+	}
+	if rep.Truncated {
+		fmt.Fprintf(os.Stderr, "truncated: data after byte %d is lost\n", rep.Size)
+	}
+	if rep.Lost() {
+		return fmt.Errorf("recovered %s with losses", *outPath)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cravtos/huffman/internal/pkg/sign"
+)
+
+// keygen writes new Ed25519 key pair.
+func keygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	name := flags.String("o", "huffman", "Base name of key files: name.key is private key, name.pub is public key.")
+	flags.Parse(args)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	privPEM, err := sign.MarshalPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	pubPEM, err := sign.MarshalPublicKey(pub)
+	if err != nil {
+		return err
+	}
+
+	// Do not overwrite existing keys
+	f, err := os.OpenFile(*name+".key", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(privPEM); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(*name+".pub", pubPEM, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %s.key and %s.pub, key %s\n", *name, *name, sign.Fingerprint(pub))
+	return nil
+}
+
+// signFile signs file with private key, appending signature trailer
+// or writing detached signature.
+func signFile(args []string) error {
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyPath := flags.String("key", "", "Private key file.")
+	detached := flags.Bool("detached", false, "Write signature to file.sig instead of appending it.")
+	flags.Parse(args)
+
+	if *keyPath == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("specify private key and file to sign")
+	}
+
+	priv, err := sign.ReadPrivateKey(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	name := flags.Arg(0)
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Existing signature is replaced
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size, _, err := sign.Split(f, stat.Size())
+	if err != nil {
+		return err
+	}
+
+	trailer, err := sign.Sign(priv, io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return err
+	}
+
+	if *detached {
+		return ioutil.WriteFile(name+sign.Ext, trailer, 0644)
+	}
+	if err = f.Truncate(size); err != nil {
+		return err
+	}
+	if _, err = f.WriteAt(trailer, size); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// verifySig checks signature of file against public key.
+func verifySig(args []string) error {
+	flags := flag.NewFlagSet("verify-sig", flag.ExitOnError)
+	pubPath := flags.String("pub", "", "Public key file.")
+	sigPath := flags.String("sig", "", "Detached signature file, defaults to file.sig if file has no signature trailer.")
+	flags.Parse(args)
+
+	if *pubPath == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("specify public key and file to verify")
+	}
+
+	pub, err := sign.ReadPublicKey(*pubPath)
+	if err != nil {
+		return err
+	}
+	if err = sign.VerifyFile(flags.Arg(0), *sigPath, pub); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: signature is valid, key %s\n", flags.Arg(0), sign.Fingerprint(pub))
+	return nil
+}
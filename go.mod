@@ -1,5 +1,8 @@
 module github.com/cravtos/huffman
 
-go 1.16
+go 1.18
 
-require github.com/icza/bitio v1.0.0
+require (
+	github.com/icza/bitio v1.0.0
+	golang.org/x/crypto v0.14.0
+)
@@ -0,0 +1,308 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// magic starts and ends every archive.
+const magic = "HFA1"
+
+// footerSize is the size of archive footer: uint64 (directory offset),
+// uint32 (directory checksum) and magic.
+const footerSize = 8 + 4 + 4
+
+// Type is a type of archive entry.
+type Type byte
+
+const (
+	// File is a regular file.
+	File Type = iota
+	// Dir is a directory.
+	Dir
+	// Symlink is a symbolic link.
+	Symlink
+)
+
+// modeMask selects file mode bits stored in archive.
+const modeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// Entry describes a file stored in archive.
+type Entry struct {
+	Path    string      // Slash separated path relative to archive root
+	Type    Type        // Type of entry
+	Mode    os.FileMode // Permission bits
+	ModTime time.Time   // Modification time
+	Size    int64       // Size of original file
+	Link    string      // Target of symbolic link
+
+	offset int64 // Offset of compressed data in archive
+	csize  int64 // Size of compressed data
+}
+
+// CompressedSize returns size of compressed data of entry.
+func (e *Entry) CompressedSize() int64 {
+	return e.csize
+}
+
+// checkPath returns error if p is not a clean relative path inside archive root.
+func checkPath(p string) error {
+	if p == "" || p == "." {
+		return errors.New("empty path")
+	}
+	if path.IsAbs(p) || strings.HasPrefix(p, "/") || strings.Contains(p, "\\") {
+		return fmt.Errorf("path %q is not relative", p)
+	}
+	if path.Clean(p) != p {
+		return fmt.Errorf("path %q is not clean", p)
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("path %q is outside of archive", p)
+	}
+	return nil
+}
+
+// writeEntry writes directory record of entry.
+//
+// Record: uint16 (path length), path, uint8 (type), uint32 (mode),
+// int64 (mtime in unix nanoseconds), int64 (size),
+// int64 (data offset), int64 (compressed size),
+// uint16 (link length), link
+func writeEntry(w io.Writer, e *Entry) error {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, uint16(len(e.Path)))
+	buf.WriteString(e.Path)
+	buf.WriteByte(byte(e.Type))
+	binary.Write(&buf, binary.BigEndian, uint32(e.Mode&modeMask))
+	binary.Write(&buf, binary.BigEndian, e.ModTime.UnixNano())
+	binary.Write(&buf, binary.BigEndian, e.Size)
+	binary.Write(&buf, binary.BigEndian, e.offset)
+	binary.Write(&buf, binary.BigEndian, e.csize)
+	binary.Write(&buf, binary.BigEndian, uint16(len(e.Link)))
+	buf.WriteString(e.Link)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readEntry reads directory record written by writeEntry.
+func readEntry(r io.Reader) (*Entry, error) {
+	var e Entry
+	var n uint16
+
+	readString := func(s *string) error {
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return err
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		*s = string(b)
+		return nil
+	}
+
+	if err := readString(&e.Path); err != nil {
+		return nil, err
+	}
+
+	var fixed struct {
+		Type   Type
+		Mode   uint32
+		MTime  int64
+		Size   int64
+		Offset int64
+		CSize  int64
+	}
+	if err := binary.Read(r, binary.BigEndian, &fixed); err != nil {
+		return nil, err
+	}
+	e.Type = fixed.Type
+	e.Mode = os.FileMode(fixed.Mode) & modeMask
+	e.ModTime = time.Unix(0, fixed.MTime)
+	e.Size, e.offset, e.csize = fixed.Size, fixed.Offset, fixed.CSize
+
+	if err := readString(&e.Link); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// countWriter counts bytes written to underlying writer.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Writer writes entries to archive.
+type Writer struct {
+	w       *countWriter
+	opts    huffman.Options
+	entries []*Entry
+	paths   map[string]bool
+}
+
+// NewWriter starts archive written to w. Files are encoded using opts.
+func NewWriter(w io.Writer, opts huffman.Options) (*Writer, error) {
+	aw := &Writer{
+		w:     &countWriter{w: w},
+		opts:  opts,
+		paths: make(map[string]bool),
+	}
+
+	if _, err := io.WriteString(aw.w, magic); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// Add adds entry to archive. Content of regular files is read from r.
+func (aw *Writer) Add(e Entry, r io.Reader) error {
+	if err := checkPath(e.Path); err != nil {
+		return err
+	}
+	if aw.paths[e.Path] {
+		return fmt.Errorf("duplicate path %q", e.Path)
+	}
+	if len(e.Path) > 1<<16-1 || len(e.Link) > 1<<16-1 {
+		return fmt.Errorf("path of %q is too long", e.Path)
+	}
+
+	e.offset, e.csize = aw.w.n, 0
+	if e.Type == File {
+		if err := huffman.EncodeWith(r, aw.w, aw.opts); err != nil {
+			return fmt.Errorf("%s: %v", e.Path, err)
+		}
+		e.csize = aw.w.n - e.offset
+	}
+
+	aw.paths[e.Path] = true
+	aw.entries = append(aw.entries, &e)
+	return nil
+}
+
+// Close writes central directory and footer. It does not close underlying writer.
+//
+// Directory: uint32 (number of entries) and record of every entry.
+// Footer: uint64 (directory offset), uint32 (CRC-32 of directory) and magic.
+func (aw *Writer) Close() error {
+	var dir bytes.Buffer
+	binary.Write(&dir, binary.BigEndian, uint32(len(aw.entries)))
+	for _, e := range aw.entries {
+		if err := writeEntry(&dir, e); err != nil {
+			return err
+		}
+	}
+
+	offset := aw.w.n
+	if _, err := aw.w.Write(dir.Bytes()); err != nil {
+		return err
+	}
+
+	var footer bytes.Buffer
+	binary.Write(&footer, binary.BigEndian, offset)
+	binary.Write(&footer, binary.BigEndian, crc32.ChecksumIEEE(dir.Bytes()))
+	footer.WriteString(magic)
+	_, err := aw.w.Write(footer.Bytes())
+	return err
+}
+
+// Reader gives access to entries of archive.
+type Reader struct {
+	r       io.ReaderAt
+	Entries []*Entry
+}
+
+// NewReader reads central directory of archive of given size.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < int64(len(magic)+footerSize) {
+		return nil, errors.New("archive is too short")
+	}
+
+	head := make([]byte, len(magic))
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-footerSize); err != nil {
+		return nil, err
+	}
+	if string(head) != magic || string(footer[12:]) != magic {
+		return nil, errors.New("not an archive")
+	}
+
+	offset := int64(binary.BigEndian.Uint64(footer))
+	sum := binary.BigEndian.Uint32(footer[8:])
+	if offset < int64(len(magic)) || offset > size-footerSize {
+		return nil, errors.New("bad directory offset")
+	}
+
+	dir := make([]byte, size-footerSize-offset)
+	if _, err := r.ReadAt(dir, offset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(dir) != sum {
+		return nil, errors.New("directory checksum mismatch")
+	}
+
+	dr := bytes.NewReader(dir)
+	var n uint32
+	if err := binary.Read(dr, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+
+	ar := &Reader{r: r}
+	paths := make(map[string]bool)
+	for i := uint32(0); i < n; i++ {
+		e, err := readEntry(dr)
+		if err != nil {
+			return nil, fmt.Errorf("directory entry %d: %v", i, err)
+		}
+		if e.offset < 0 || e.csize < 0 || e.offset+e.csize > offset {
+			return nil, fmt.Errorf("%s: bad data range", e.Path)
+		}
+		if paths[e.Path] {
+			return nil, fmt.Errorf("%s: duplicate path", e.Path)
+		}
+		paths[e.Path] = true
+		ar.Entries = append(ar.Entries, e)
+	}
+
+	return ar, nil
+}
+
+// Find returns entry by its path or nil.
+func (ar *Reader) Find(p string) *Entry {
+	for _, e := range ar.Entries {
+		if e.Path == p {
+			return e
+		}
+	}
+	return nil
+}
+
+// Decode writes decoded content of regular file entry to w.
+func (ar *Reader) Decode(e *Entry, w io.Writer) error {
+	if e.Type != File {
+		return fmt.Errorf("%s is not a regular file", e.Path)
+	}
+	return huffman.Decode(io.NewSectionReader(ar.r, e.offset, e.csize), w)
+}
@@ -0,0 +1,251 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// Pack writes archive of everything under root directory to w.
+// Files other than regular ones, directories and symbolic links are skipped.
+func Pack(w io.Writer, root string, opts huffman.Options) error {
+	aw, err := NewWriter(w, opts)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		e := Entry{
+			Path:    filepath.ToSlash(rel),
+			Mode:    info.Mode() & modeMask,
+			ModTime: info.ModTime(),
+		}
+
+		switch {
+		case info.Mode().IsRegular():
+			e.Type, e.Size = File, info.Size()
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return aw.Add(e, f)
+		case info.IsDir():
+			e.Type = Dir
+		case info.Mode()&os.ModeSymlink != 0:
+			e.Type = Symlink
+			if e.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		return aw.Add(e, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	return aw.Close()
+}
+
+// Extract writes entries with given paths to dir, or all entries if paths are empty.
+// Entries which would be placed outside of dir are refused.
+// Setuid, setgid and sticky bits are restored only if special is set.
+func (ar *Reader) Extract(dir string, paths []string, special bool) error {
+	entries := ar.Entries
+	if len(paths) != 0 {
+		entries = nil
+		for _, p := range paths {
+			e := ar.Find(p)
+			if e == nil {
+				return fmt.Errorf("%s: not found in archive", p)
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	var dirs []*Entry
+	for _, e := range entries {
+		if err := ar.extract(dir, e, special); err != nil {
+			return fmt.Errorf("%s: %v", e.Path, err)
+		}
+		if e.Type == Dir {
+			dirs = append(dirs, e)
+		}
+	}
+
+	// Restore directories metadata after their content is written.
+	// Chmod and Chtimes follow symbolic links, so directories are checked again
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target := filepath.Join(dir, filepath.FromSlash(dirs[i].Path))
+		if err := checkDir(dir, dirs[i].Path); err != nil {
+			return fmt.Errorf("%s: %v", dirs[i].Path, err)
+		}
+		if err := os.Chmod(target, extractMode(dirs[i], special)); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, dirs[i].ModTime, dirs[i].ModTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extract writes single entry to dir.
+func (ar *Reader) extract(dir string, e *Entry, special bool) error {
+	if err := checkPath(e.Path); err != nil {
+		return err
+	}
+	if err := checkParents(dir, e.Path); err != nil {
+		return err
+	}
+
+	target := filepath.Join(dir, filepath.FromSlash(e.Path))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	switch e.Type {
+	case Dir:
+		if err := checkDir(dir, e.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.MkdirAll(target, 0700)
+	case Symlink:
+		if err := ar.checkLink(e.Path, e.Link); err != nil {
+			return err
+		}
+		if err := removeLink(target); err != nil {
+			return err
+		}
+		return os.Symlink(e.Link, target)
+	case File:
+		if err := removeLink(target); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err = ar.Decode(e, f); err != nil {
+			return err
+		}
+		if err = f.Chmod(extractMode(e, special)); err != nil {
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(target, e.ModTime, e.ModTime)
+	}
+
+	return fmt.Errorf("unknown entry type %d", e.Type)
+}
+
+// extractMode returns mode of extracted entry, dropping setuid, setgid
+// and sticky bits unless special is set.
+func extractMode(e *Entry, special bool) os.FileMode {
+	if special {
+		return e.Mode
+	}
+	return e.Mode & os.ModePerm
+}
+
+// checkParents returns error if any parent directory of p inside dir is a symbolic link,
+// since writing through it could escape dir.
+func checkParents(dir, p string) error {
+	parts := strings.Split(p, "/")
+	cur := dir
+	for _, part := range parts[:len(parts)-1] {
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("parent %s is a symbolic link", cur)
+		}
+	}
+	return nil
+}
+
+// checkDir returns error if p inside dir is not a directory or any part of it
+// is a symbolic link, so that changing it can not affect anything outside of dir.
+func checkDir(dir, p string) error {
+	if err := checkParents(dir, p); err != nil {
+		return err
+	}
+	info, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(p)))
+	switch {
+	case err != nil:
+		return err
+	case info.Mode()&os.ModeSymlink != 0:
+		return errors.New("directory is a symbolic link")
+	case !info.IsDir():
+		return errors.New("not a directory")
+	}
+	return nil
+}
+
+// checkLink returns error if symbolic link at p pointing to link could lead outside of archive root.
+// Link must not go up with "..", and must not pass through other links of archive,
+// since they could be chained to escape it.
+func (ar *Reader) checkLink(p, link string) error {
+	if link == "" || path.IsAbs(link) || strings.HasPrefix(link, "/") {
+		return fmt.Errorf("link target %q is not relative", link)
+	}
+	for _, part := range strings.Split(link, "/") {
+		if part == ".." {
+			return fmt.Errorf("link target %q goes up with ..", link)
+		}
+	}
+
+	target := path.Join(path.Dir(p), link)
+	for cur := target; cur != "." && cur != "/"; cur = path.Dir(cur) {
+		if e := ar.Find(cur); e != nil && e.Type == Symlink {
+			return fmt.Errorf("link target %q passes through link %s", link, cur)
+		}
+	}
+	return nil
+}
+
+// removeLink removes symbolic link at p, so that it is not followed when writing.
+func removeLink(p string) error {
+	info, err := os.Lstat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(p)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package arith
+
+import (
+	"io"
+
+	"github.com/cravtos/huffman/internal/pkg/model"
+	"github.com/icza/bitio"
+)
+
+// Coder works with 32 bit integer range.
+const (
+	full    = 1<<32 - 1
+	half    = 1 << 31
+	quarter = 1 << 30
+)
+
+// Encode does arithmetic coding of symbols using model m and writes bits to w.
+func Encode(w *bitio.Writer, m *model.Model, data []uint32) error {
+	var low, high uint64 = 0, full
+	var pending int
+
+	// emit writes bit followed by pending opposite bits.
+	emit := func(bit uint64) {
+		w.TryWriteBitsUnsafe(bit, 1)
+		for ; pending > 0; pending-- {
+			w.TryWriteBitsUnsafe(bit^1, 1)
+		}
+	}
+
+	for _, v := range data {
+		start, freq := m.Lookup(v)
+
+		rng := high - low + 1
+		high = low + rng*uint64(start+freq)/model.Total - 1
+		low = low + rng*uint64(start)/model.Total
+
+	scale:
+		for {
+			switch {
+			case high < half:
+				emit(0)
+			case low >= half:
+				emit(1)
+				low -= half
+				high -= half
+			case low >= quarter && high < half+quarter:
+				pending++
+				low -= quarter
+				high -= quarter
+			default:
+				break scale
+			}
+			low <<= 1
+			high = high<<1 | 1
+		}
+	}
+
+	// Write enough bits to distinguish final range
+	pending++
+	if low < quarter {
+		emit(0)
+	} else {
+		emit(1)
+	}
+
+	return w.TryError
+}
+
+// Decode decodes n symbols from r using model m.
+// Missing bits at the end of input are treated as zeros.
+func Decode(r *bitio.Reader, m *model.Model, n int) ([]uint32, error) {
+	// n comes from untrusted header, so memory grows as symbols are decoded
+	size := n
+	if size > 1<<16 {
+		size = 1 << 16
+	}
+	data := make([]uint32, 0, size)
+	if n == 0 {
+		return data, nil
+	}
+
+	// next returns next bit of input.
+	next := func() (uint64, error) {
+		u, err := r.ReadBits(1)
+		if err == io.EOF {
+			return 0, nil
+		}
+		return u, err
+	}
+
+	var low, high, value uint64 = 0, full, 0
+	for i := 0; i < 32; i++ {
+		bit, err := next()
+		if err != nil {
+			return nil, err
+		}
+		value = value<<1 | bit
+	}
+
+	for len(data) < n {
+		rng := high - low + 1
+		slot := ((value-low+1)*model.Total - 1) / rng
+		sym, start, freq := m.Find(uint32(slot))
+		data = append(data, sym)
+
+		high = low + rng*uint64(start+freq)/model.Total - 1
+		low = low + rng*uint64(start)/model.Total
+
+	scale:
+		for {
+			switch {
+			case high < half:
+			case low >= half:
+				low -= half
+				high -= half
+				value -= half
+			case low >= quarter && high < half+quarter:
+				low -= quarter
+				high -= quarter
+				value -= quarter
+			default:
+				break scale
+			}
+			bit, err := next()
+			if err != nil {
+				return nil, err
+			}
+			low <<= 1
+			high = high<<1 | 1
+			value = value<<1 | bit
+		}
+	}
+
+	return data, nil
+}
@@ -1,7 +1,7 @@
 package code
 
-// Table maps byte to its code.
-type Table map[byte]Code
+// Table maps symbol to its code.
+type Table map[uint32]Code
 
 // Code represents code in boolean vector.
 type Code struct {
@@ -0,0 +1,141 @@
+package corpus
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Kind is a kind of synthetic data.
+type Kind string
+
+const (
+	// Uniform is bytes drawn uniformly from a 64 symbol alphabet.
+	Uniform Kind = "uniform"
+	// Zipf is bytes with Zipf distribution, byte k having probability proportional to 1/(k+1)^1.2.
+	Zipf Kind = "zipf"
+	// Geometric is bytes with geometric distribution, byte k having probability 0.3*0.7^k.
+	Geometric Kind = "geometric"
+	// Markov is text of words produced by first order Markov chain.
+	Markov Kind = "markov"
+	// Random is random bytes, which can not be compressed.
+	Random Kind = "random"
+)
+
+// Kinds returns all kinds of synthetic data.
+func Kinds() []Kind {
+	return []Kind{Uniform, Zipf, Geometric, Markov, Random}
+}
+
+// ParseKinds parses comma separated list of kinds. "all" means every kind,
+// and empty list or "none" means no kind.
+func ParseKinds(s string) ([]Kind, error) {
+	switch s {
+	case "all":
+		return Kinds(), nil
+	case "", "none":
+		return nil, nil
+	}
+
+	var kinds []Kind
+	for _, name := range strings.Split(s, ",") {
+		k, ok := Kind(strings.TrimSpace(name)), false
+		for _, known := range Kinds() {
+			ok = ok || k == known
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown corpus %q", name)
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
+
+// Generate returns size bytes of synthetic data of given kind.
+// The same seed always gives the same data.
+func Generate(kind Kind, size int, seed int64) ([]byte, error) {
+	rnd := rand.New(rand.NewSource(seed))
+	data := make([]byte, size)
+
+	switch kind {
+	case Uniform:
+		for i := range data {
+			data[i] = byte(rnd.Intn(64)) + ' '
+		}
+	case Zipf:
+		z := rand.NewZipf(rnd, 1.2, 1, 255)
+		for i := range data {
+			data[i] = byte(z.Uint64())
+		}
+	case Geometric:
+		for i := range data {
+			k := 0
+			for k < 255 && rnd.Float64() >= 0.3 {
+				k++
+			}
+			data[i] = byte(k)
+		}
+	case Markov:
+		markov(data, rnd)
+	case Random:
+		rnd.Read(data)
+	default:
+		return nil, fmt.Errorf("unknown corpus %q", kind)
+	}
+	return data, nil
+}
+
+// markov fills data with text of words produced by first order Markov chain.
+// Every word is followed by one of few other words, more likely by the first ones.
+func markov(data []byte, rnd *rand.Rand) {
+	const (
+		nWords = 500
+		nNext  = 8
+	)
+	syllables := []string{
+		"the", "an", "of", "to", "in", "is", "it", "on", "re", "er", "at", "en",
+		"ing", "ion", "and", "for", "con", "ter", "ver", "al", "ly", "st", "ch", "th",
+	}
+
+	words := make([]string, nWords)
+	next := make([][]int, nWords)
+	for i := range words {
+		var w strings.Builder
+		for n := 1 + rnd.Intn(3); n > 0; n-- {
+			w.WriteString(syllables[rnd.Intn(len(syllables))])
+		}
+		words[i] = w.String()
+
+		next[i] = make([]int, nNext)
+		for j := range next[i] {
+			next[i][j] = rnd.Intn(nWords)
+		}
+	}
+
+	var text []byte
+	w, sentence := 0, 0
+	for len(text) < len(data) {
+		word := words[w]
+		if sentence == 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		text = append(text, word...)
+
+		// Sentences end after about ten words
+		sentence++
+		if rnd.Intn(10) == 0 {
+			text = append(text, ". "...)
+			sentence = 0
+		} else {
+			text = append(text, ' ')
+		}
+
+		// The first successors are the most likely ones
+		j := 0
+		for j < nNext-1 && rnd.Intn(2) == 0 {
+			j++
+		}
+		w = next[w][j]
+	}
+	copy(data, text)
+}
@@ -0,0 +1,370 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Layout:
+//
+//	header: magic, uint8 (kdf), uint8 (log2 of scrypt N), uint8 (scrypt r), uint8 (scrypt p),
+//	        salt, uint32 (chunk size)
+//	chunks, each: uint32 (size of data, lastChunk flag), sealed data
+//
+// Data is encrypted with AES-256-GCM in chunks (STREAM construction):
+// nonce of every chunk is its number and last chunk flag, so chunks can not be
+// reordered, dropped or appended. Header and chunk header are authenticated as well.
+// Key of every stream is derived from passphrase or raw key and random salt.
+const (
+	Magic      = "HUFE"
+	HeaderSize = 4 + 4 + saltSize + 4
+
+	// KeySize is the size of raw key.
+	KeySize = 32
+
+	// DefaultChunkSize is the amount of data encrypted in one chunk.
+	DefaultChunkSize = 64 * 1024
+	maxChunkSize     = 1 << 24
+
+	// Default cost of scrypt, about 32 MiB of memory.
+	DefaultLogN = 15
+	DefaultR    = 8
+	DefaultP    = 1
+	maxP        = 16
+	maxMemory   = 1 << 30 // Bytes used by scrypt, 128*r*N
+	maxWork     = 1 << 24 // Blocks mixed by scrypt, p*r*N
+
+	saltSize  = 16
+	lastChunk = 1 << 31
+)
+
+// Key derivation functions.
+const (
+	kdfRaw    byte = 0
+	kdfScrypt byte = 1
+)
+
+// ErrAuth is returned when chunk can not be decrypted.
+var ErrAuth = errors.New("crypt: authentication failed: wrong passphrase or key, or data was tampered with")
+
+// ErrNoKey is returned when encrypted stream is read without passphrase or key.
+var ErrNoKey = errors.New("crypt: stream is encrypted, passphrase or key is required")
+
+// Secret is a passphrase or raw key. Exactly one of them is set.
+type Secret struct {
+	Passphrase []byte
+	Key        []byte // KeySize bytes
+}
+
+// IsZero reports whether secret is not set.
+func (s Secret) IsZero() bool {
+	return s.Passphrase == nil && s.Key == nil
+}
+
+// Validate checks whether secret is usable.
+func (s Secret) Validate() error {
+	switch {
+	case s.Passphrase != nil && s.Key != nil:
+		return errors.New("crypt: both passphrase and key are set")
+	case s.Key != nil && len(s.Key) != KeySize:
+		return fmt.Errorf("crypt: key must be %d bytes, got %d", KeySize, len(s.Key))
+	case s.Passphrase != nil && len(s.Passphrase) == 0:
+		return errors.New("crypt: empty passphrase")
+	}
+	return nil
+}
+
+// header holds parameters of encrypted stream.
+type header struct {
+	kdf       byte
+	logN      uint8
+	r, p      uint8
+	salt      [saltSize]byte
+	chunkSize uint32
+}
+
+func (h header) encode() []byte {
+	b := append([]byte(Magic), h.kdf, h.logN, h.r, h.p)
+	b = append(b, h.salt[:]...)
+	b = append(b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[len(b)-4:], h.chunkSize)
+	return b
+}
+
+// Detect reports whether head starts encrypted stream.
+func Detect(head []byte) bool {
+	return len(head) >= len(Magic) && string(head[:len(Magic)]) == Magic
+}
+
+// parseHeader returns parameters of encrypted stream.
+func parseHeader(b []byte) (h header, err error) {
+	if !Detect(b) {
+		return h, errors.New("crypt: not an encrypted stream")
+	}
+	h.kdf, h.logN, h.r, h.p = b[4], b[5], b[6], b[7]
+	copy(h.salt[:], b[8:])
+	h.chunkSize = binary.BigEndian.Uint32(b[8+saltSize:])
+
+	switch h.kdf {
+	case kdfRaw:
+	case kdfScrypt:
+		// Refuse costs which would exhaust memory or take too long before
+		// the first chunk is authenticated
+		if h.logN == 0 || h.logN > 24 || h.r == 0 || h.p == 0 || h.p > maxP ||
+			128*uint64(h.r)<<h.logN > maxMemory || uint64(h.p)*uint64(h.r)<<h.logN > maxWork {
+			return h, fmt.Errorf("crypt: bad scrypt parameters N=2^%d r=%d p=%d", h.logN, h.r, h.p)
+		}
+	default:
+		return h, fmt.Errorf("crypt: unknown key derivation %d", h.kdf)
+	}
+	if h.chunkSize == 0 || h.chunkSize > maxChunkSize {
+		return h, fmt.Errorf("crypt: bad chunk size %d", h.chunkSize)
+	}
+	return h, nil
+}
+
+// aead returns cipher keyed by secret and stream parameters.
+func (h header) aead(s Secret) (cipher.AEAD, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	switch {
+	case s.IsZero():
+		return nil, ErrNoKey
+	case h.kdf == kdfRaw && s.Key == nil:
+		return nil, errors.New("crypt: stream is encrypted with raw key, not passphrase")
+	case h.kdf == kdfScrypt && s.Passphrase == nil:
+		return nil, errors.New("crypt: stream is encrypted with passphrase, not raw key")
+	case h.kdf == kdfRaw:
+		mac := hmac.New(sha256.New, s.Key)
+		mac.Write(h.salt[:])
+		key = mac.Sum(nil)
+	default:
+		var err error
+		key, err = scrypt.Key(s.Passphrase, h.salt[:], 1<<h.logN, int(h.r), int(h.p), KeySize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns nonce of n-th chunk.
+func chunkNonce(nonce []byte, n uint32, last bool) []byte {
+	for i := range nonce {
+		nonce[i] = 0
+	}
+	binary.BigEndian.PutUint32(nonce[len(nonce)-5:], n)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// Writer encrypts data written to it.
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	ad     []byte // Header followed by chunk header
+	nonce  []byte
+	buf    []byte
+	sealed []byte
+	chunk  uint32 // Number of current chunk
+	err    error
+}
+
+// NewWriter returns Writer encrypting data with key derived from secret,
+// and writes stream header to w.
+func NewWriter(w io.Writer, s Secret) (*Writer, error) {
+	h := header{kdf: kdfRaw, chunkSize: DefaultChunkSize}
+	if s.Passphrase != nil {
+		h.kdf, h.logN, h.r, h.p = kdfScrypt, DefaultLogN, DefaultR, DefaultP
+	}
+	if _, err := io.ReadFull(rand.Reader, h.salt[:]); err != nil {
+		return nil, err
+	}
+
+	aead, err := h.aead(s)
+	if err != nil {
+		return nil, err
+	}
+
+	head := h.encode()
+	cw := &Writer{
+		w:     w,
+		aead:  aead,
+		ad:    append(head, 0, 0, 0, 0),
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, 0, h.chunkSize),
+	}
+	_, cw.err = w.Write(head)
+	return cw, cw.err
+}
+
+// Write buffers p and encrypts every filled chunk.
+// The last chunk is written by Close, so a filled chunk is written only
+// when more data follows it.
+func (cw *Writer) Write(p []byte) (n int, err error) {
+	for len(p) > 0 && cw.err == nil {
+		if len(cw.buf) == cap(cw.buf) {
+			cw.err = cw.writeChunk(false)
+			continue
+		}
+
+		k := copy(cw.buf[len(cw.buf):cap(cw.buf)], p)
+		cw.buf = cw.buf[:len(cw.buf)+k]
+		n += k
+		p = p[k:]
+	}
+	return n, cw.err
+}
+
+// writeChunk encrypts and writes buffered data.
+func (cw *Writer) writeChunk(last bool) error {
+	size := uint32(len(cw.buf))
+	if last {
+		size |= lastChunk
+	}
+	chunkHeader := cw.ad[len(cw.ad)-4:]
+	binary.BigEndian.PutUint32(chunkHeader, size)
+
+	cw.sealed = append(cw.sealed[:0], chunkHeader...)
+	cw.sealed = cw.aead.Seal(cw.sealed, chunkNonce(cw.nonce, cw.chunk, last), cw.buf, cw.ad)
+	cw.buf = cw.buf[:0]
+	cw.chunk++
+	if cw.chunk == 0 {
+		return errors.New("crypt: too many chunks")
+	}
+
+	_, err := cw.w.Write(cw.sealed)
+	return err
+}
+
+// Close encrypts and writes the last chunk. It does not close the underlying writer.
+func (cw *Writer) Close() error {
+	if cw.err != nil {
+		return cw.err
+	}
+	if cw.err = cw.writeChunk(true); cw.err != nil {
+		return cw.err
+	}
+	cw.err = errors.New("crypt: write to closed stream")
+	return nil
+}
+
+// Reader decrypts stream written by Writer.
+// Only authenticated data is returned, and end of stream is reported
+// only after the last chunk, so truncated stream is detected.
+type Reader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	ad    []byte
+	nonce []byte
+	size  uint32 // Chunk size
+	buf   []byte
+	data  []byte // Decrypted data not read yet
+	chunk uint32
+	done  bool // The last chunk was read
+	err   error
+}
+
+// NewReader returns Reader decrypting stream read from r with key derived from secret.
+// Stream header is read immediately. Nothing is read after the last chunk.
+func NewReader(r io.Reader, s Secret) (*Reader, error) {
+	head := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	h, err := parseHeader(head)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := h.aead(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		r:     r,
+		aead:  aead,
+		ad:    append(head, 0, 0, 0, 0),
+		nonce: make([]byte, aead.NonceSize()),
+		size:  h.chunkSize,
+	}, nil
+}
+
+// Read reads decrypted data, decrypting next chunk when needed.
+func (cr *Reader) Read(p []byte) (n int, err error) {
+	for len(cr.data) == 0 && cr.err == nil {
+		cr.err = cr.nextChunk()
+	}
+
+	n = copy(p, cr.data)
+	cr.data = cr.data[n:]
+	if len(cr.data) == 0 && n > 0 {
+		return n, nil
+	}
+	return n, cr.err
+}
+
+// nextChunk reads and decrypts next chunk.
+func (cr *Reader) nextChunk() error {
+	if cr.done {
+		return io.EOF
+	}
+
+	chunkHeader := cr.ad[len(cr.ad)-4:]
+	if _, err := io.ReadFull(cr.r, chunkHeader); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: stream is truncated", ErrAuth)
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(chunkHeader)
+	last := size&lastChunk != 0
+	size &^= lastChunk
+	if size > cr.size {
+		return ErrAuth
+	}
+
+	n := int(size) + cr.aead.Overhead()
+	if cap(cr.buf) < n {
+		cr.buf = make([]byte, n)
+	}
+	if _, err := io.ReadFull(cr.r, cr.buf[:n]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: stream is truncated", ErrAuth)
+		}
+		return err
+	}
+
+	data, err := cr.aead.Open(cr.buf[:0], chunkNonce(cr.nonce, cr.chunk, last), cr.buf[:n], cr.ad)
+	if err != nil {
+		return ErrAuth
+	}
+
+	cr.chunk++
+	cr.done = last
+	cr.data = data
+	if len(data) == 0 && last {
+		return io.EOF
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// PassphraseEnv is the environment variable holding passphrase.
+const PassphraseEnv = "HUFFMAN_PASSPHRASE"
+
+// LoadSecret returns raw key read from keyFile, or passphrase read from passFile
+// or PassphraseEnv. Empty file names are skipped.
+// Zero Secret is returned if there is no key and no passphrase.
+func LoadSecret(keyFile, passFile string) (Secret, error) {
+	switch {
+	case keyFile != "" && passFile != "":
+		return Secret{}, errors.New("specify either key file or passphrase file")
+	case keyFile != "":
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return Secret{}, err
+		}
+		s := Secret{Key: key}
+		return s, s.Validate()
+	case passFile != "":
+		pass, err := ioutil.ReadFile(passFile)
+		if err != nil {
+			return Secret{}, err
+		}
+		s := Secret{Passphrase: bytes.TrimRight(pass, "\r\n")}
+		return s, s.Validate()
+	}
+
+	if pass, ok := os.LookupEnv(PassphraseEnv); ok {
+		s := Secret{Passphrase: []byte(pass)}
+		return s, s.Validate()
+	}
+	return Secret{}, nil
+}
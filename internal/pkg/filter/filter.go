@@ -0,0 +1,237 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+)
+
+// Kind is a kind of filter.
+type Kind byte
+
+const (
+	// None leaves data as it is.
+	None Kind = iota
+	// Delta replaces every byte with difference to previous byte.
+	Delta
+	// Stride replaces every byte with difference to byte Param positions before.
+	Stride
+	// XOR replaces every byte with xor of itself and corresponding byte of previous
+	// record of Param bytes.
+	XOR
+	// BCJ converts relative addresses of x86 CALL and JMP instructions to absolute ones,
+	// so that calls to the same function look the same.
+	BCJ
+	// Auto picks one of other filters which makes data look simpler.
+	// It is never written to encoded data.
+	Auto
+)
+
+var kindNames = map[Kind]string{
+	None:   "none",
+	Delta:  "delta",
+	Stride: "stride",
+	XOR:    "xor",
+	BCJ:    "bcj",
+	Auto:   "auto",
+}
+
+// Filter is a reversible transformation of data applied before coding.
+type Filter struct {
+	Kind  Kind
+	Param uint32 // Distance for Stride and record size for XOR
+}
+
+// String returns filter in a form accepted by Parse.
+func (f Filter) String() string {
+	name, ok := kindNames[f.Kind]
+	if !ok {
+		return fmt.Sprintf("filter(%d)", byte(f.Kind))
+	}
+	if f.hasParam() {
+		return fmt.Sprintf("%s:%d", name, f.Param)
+	}
+	return name
+}
+
+// hasParam reports whether filter uses Param.
+func (f Filter) hasParam() bool {
+	return f.Kind == Stride || f.Kind == XOR
+}
+
+// Parse returns filter by its description, e.g. "delta", "stride:4" or "xor:16".
+func Parse(s string) (Filter, error) {
+	name, param := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, param = s[:i], s[i+1:]
+	}
+
+	for k, n := range kindNames {
+		if n != name {
+			continue
+		}
+
+		f := Filter{Kind: k}
+		if !f.hasParam() {
+			if param != "" {
+				return Filter{}, fmt.Errorf("filter %s takes no parameter", name)
+			}
+			return f, nil
+		}
+
+		p, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			return Filter{}, fmt.Errorf("bad parameter of filter %s: %q", name, param)
+		}
+		f.Param = uint32(p)
+		return f, f.Validate()
+	}
+
+	return Filter{}, fmt.Errorf("unknown filter %q", name)
+}
+
+// ParseList parses comma separated list of filters.
+func ParseList(s string) ([]Filter, error) {
+	var filters []Filter
+	for _, part := range strings.Split(s, ",") {
+		f, err := Parse(part)
+		if err != nil {
+			return nil, err
+		}
+		if f.Kind != None {
+			filters = append(filters, f)
+		}
+	}
+	return filters, nil
+}
+
+// Validate checks filter kind and parameter.
+func (f Filter) Validate() error {
+	if _, ok := kindNames[f.Kind]; !ok {
+		return fmt.Errorf("unknown filter %d", f.Kind)
+	}
+	if f.hasParam() && f.Param == 0 {
+		return fmt.Errorf("filter %s needs positive parameter", kindNames[f.Kind])
+	}
+	return nil
+}
+
+// Encode applies filter to data in place.
+func (f Filter) Encode(data []byte) {
+	switch f.Kind {
+	case Delta:
+		stride(data, 1, false)
+	case Stride:
+		stride(data, int(f.Param), false)
+	case XOR:
+		xor(data, int(f.Param), false)
+	case BCJ:
+		bcj(data, true)
+	}
+}
+
+// Decode reverts filter applied by Encode in place.
+func (f Filter) Decode(data []byte) {
+	switch f.Kind {
+	case Delta:
+		stride(data, 1, true)
+	case Stride:
+		stride(data, int(f.Param), true)
+	case XOR:
+		xor(data, int(f.Param), true)
+	case BCJ:
+		bcj(data, false)
+	}
+}
+
+// stride replaces every byte with difference to byte n positions before, or reverts it.
+func stride(data []byte, n int, decode bool) {
+	if decode {
+		for i := n; i < len(data); i++ {
+			data[i] += data[i-n]
+		}
+		return
+	}
+
+	for i := len(data) - 1; i >= n; i-- {
+		data[i] -= data[i-n]
+	}
+}
+
+// xor replaces every byte with xor of itself and byte n positions before, or reverts it.
+func xor(data []byte, n int, decode bool) {
+	if decode {
+		for i := n; i < len(data); i++ {
+			data[i] ^= data[i-n]
+		}
+		return
+	}
+
+	for i := len(data) - 1; i >= n; i-- {
+		data[i] ^= data[i-n]
+	}
+}
+
+// bcj converts 32 bit relative operands of x86 CALL (0xE8) and JMP (0xE9)
+// to absolute addresses, or back. Converted operands are skipped, so that
+// encoder and decoder visit the same positions.
+func bcj(data []byte, encode bool) {
+	for i := 0; i+5 <= len(data); {
+		if data[i] != 0xE8 && data[i] != 0xE9 {
+			i++
+			continue
+		}
+
+		op := data[i+1 : i+5]
+		v := uint32(op[0]) | uint32(op[1])<<8 | uint32(op[2])<<16 | uint32(op[3])<<24
+		if encode {
+			v += uint32(i + 5)
+		} else {
+			v -= uint32(i + 5)
+		}
+		op[0], op[1], op[2], op[3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+
+		i += 5
+	}
+}
+
+// sampleSize is the amount of data looked at by Choose.
+const sampleSize = 64 << 10
+
+// candidates are filters tried by Choose.
+var candidates = []Filter{
+	{Kind: None},
+	{Kind: Delta},
+	{Kind: Stride, Param: 2},
+	{Kind: Stride, Param: 3},
+	{Kind: Stride, Param: 4},
+	{Kind: Stride, Param: 8},
+	{Kind: XOR, Param: 4},
+	{Kind: XOR, Param: 8},
+	{Kind: XOR, Param: 16},
+	{Kind: BCJ},
+}
+
+// Choose applies every candidate filter to a sample of data and returns
+// the one giving the lowest byte entropy.
+func Choose(data []byte) Filter {
+	if len(data) > sampleSize {
+		data = data[:sampleSize]
+	}
+
+	best, bestEntropy := Filter{Kind: None}, helpers.Entropy(helpers.CalcFreq(bytes.NewReader(data)))
+	sample := make([]byte, len(data))
+	for _, f := range candidates[1:] {
+		copy(sample, data)
+		f.Encode(sample)
+
+		if h := helpers.Entropy(helpers.CalcFreq(bytes.NewReader(sample))); h < bestEntropy {
+			best, bestEntropy = f, h
+		}
+	}
+
+	return best
+}
@@ -4,22 +4,53 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
 )
 
 // CalcFreq reads everything from ByteReader and returns byte frequencies.
-func CalcFreq(br io.ByteReader) map[uint8]uint {
-	freq := make(map[uint8]uint)
+func CalcFreq(br io.ByteReader) map[uint32]uint {
+	freq := make(map[uint32]uint)
 
 	v, err := br.ReadByte()
 	for err == nil {
-		freq[v]++
+		freq[uint32(v)]++
 		v, err = br.ReadByte()
 	}
 
 	return freq
 }
 
+// CalcSymbolFreq returns frequencies of symbols.
+func CalcSymbolFreq(symbols []uint32) map[uint32]uint {
+	freq := make(map[uint32]uint)
+	for _, v := range symbols {
+		freq[v]++
+	}
+	return freq
+}
+
+// Entropy returns Shannon entropy of symbol frequencies in bits per symbol.
+// Symbols are summed in order of their values, so the result does not depend on map order.
+func Entropy(freq map[uint32]uint) float64 {
+	symbols := make([]uint32, 0, len(freq))
+	var total float64
+	for s, f := range freq {
+		symbols = append(symbols, s)
+		total += float64(f)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+
+	var h float64
+	for _, s := range symbols {
+		p := float64(freq[s]) / total
+		h -= p * math.Log2(p)
+	}
+
+	return h
+}
+
 // PrintRatio prints compression ratio for two files.
 func PrintRatio(f *os.File, s *os.File) error {
 	inStat, err := f.Stat()
@@ -32,12 +63,14 @@ func PrintRatio(f *os.File, s *os.File) error {
 		return err
 	}
 
-	inSize := inStat.Size()
-	outSize := outStat.Size()
-	ratio := float32(inStat.Size()) / float32(outStat.Size())
+	PrintSizeRatio(inStat.Size(), outStat.Size())
+	return nil
+}
 
+// PrintSizeRatio prints sizes of input and output and ratio between them.
+func PrintSizeRatio(inSize, outSize int64) {
+	ratio := float32(inSize) / float32(outSize)
 	fmt.Printf("input size: %v\noutput size: %v\nratio: %v bytes\n", inSize, outSize, ratio)
-	return nil
 }
 
 // CompareFiles returns true if two files are equal.
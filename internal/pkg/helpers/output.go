@@ -0,0 +1,131 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Output is a temporary file in the directory of output file,
+// renamed to output file only when all data is written to it.
+// Until then the output file is left as it was.
+type Output struct {
+	*os.File
+	name   string
+	force  bool
+	cancel func() // Unregisters removal on interrupt
+}
+
+// CreateOutput creates temporary file to be renamed to named output file by Commit.
+// Existing output file is overwritten only if force is set.
+// Temporary file is removed if the process is interrupted.
+func CreateOutput(name string, force bool) (*Output, error) {
+	if err := CheckOverwrite(name, force); err != nil {
+		return nil, err
+	}
+
+	var suffix [6]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".tmp"+hex.EncodeToString(suffix[:]))
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Output{File: f, name: name, force: force}
+	out.cancel = OnInterrupt(func() {
+		f.Close()
+		os.Remove(tmp)
+	})
+	return out, nil
+}
+
+// Name returns name of output file.
+func (out *Output) Name() string {
+	return out.name
+}
+
+// Commit flushes temporary file to disk and renames it to output file.
+// The file stays open, so it can be inspected.
+func (out *Output) Commit() error {
+	defer out.cancel()
+
+	err := out.Sync()
+	if err == nil {
+		err = CheckOverwrite(out.name, out.force)
+	}
+	if err == nil {
+		err = os.Rename(out.File.Name(), out.name)
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(out.File.Name())
+	}
+	return err
+}
+
+// Abort closes and removes temporary file, leaving output file as it was.
+func (out *Output) Abort() {
+	out.Close()
+	os.Remove(out.File.Name())
+	out.cancel()
+}
+
+// CheckOverwrite returns error if named file exists, unless force is set.
+func CheckOverwrite(name string, force bool) error {
+	if force {
+		return nil
+	}
+	if _, err := os.Lstat(name); err == nil {
+		return fmt.Errorf("%s already exists, use -f to overwrite it", name)
+	}
+	return nil
+}
+
+var (
+	interruptMu   sync.Mutex
+	interruptOnce sync.Once
+	interrupts    = make(map[int]func())
+	interruptID   int
+)
+
+// OnInterrupt registers fn to be called before the process exits
+// on SIGINT or SIGTERM. Returned function unregisters fn.
+func OnInterrupt(fn func()) (cancel func()) {
+	interruptOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-c
+			interruptMu.Lock()
+			for _, fn := range interrupts {
+				fn()
+			}
+
+			// Exit status of process killed by signal
+			code := 130
+			if sig == syscall.SIGTERM {
+				code = 143
+			}
+			os.Exit(code)
+		}()
+	})
+
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	id := interruptID
+	interruptID++
+	interrupts[id] = fn
+	return func() {
+		interruptMu.Lock()
+		defer interruptMu.Unlock()
+		delete(interrupts, id)
+	}
+}
@@ -0,0 +1,284 @@
+package huffhttp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// Encoding is the content coding token of Huffman coded bodies.
+const Encoding = "x-huffman"
+
+// DefaultMinSize is the default size of the smallest compressed body.
+const DefaultMinSize = 1024
+
+// DefaultContentTypes are media types compressed by default.
+// Types ending with "/*" match every subtype.
+var DefaultContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// Config configures Handler.
+type Config struct {
+	MinSize      int             // Smaller bodies are sent as is, zero means DefaultMinSize
+	ContentTypes []string        // Compressed media types, empty means DefaultContentTypes
+	Options      huffman.Options // Options of encoder
+}
+
+// Handler compresses responses of next handler for clients which accept Encoding.
+func Handler(next http.Handler, cfg Config) http.Handler {
+	if cfg.MinSize == 0 {
+		cfg.MinSize = DefaultMinSize
+	}
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = DefaultContentTypes
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !accepts(r.Header.Get("Accept-Encoding"), Encoding) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Response to HEAD gets the same headers as response to GET, but no body
+		cw := &compressWriter{w: w, cfg: &cfg, head: r.Method == http.MethodHead}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// accepts reports whether Accept-Encoding header value allows coding with q-value above zero.
+func accepts(header, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), coding) {
+			continue
+		}
+
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				q, err := strconv.ParseFloat(p[2:], 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter buffers response body until it is known whether it should be compressed.
+type compressWriter struct {
+	w    http.ResponseWriter
+	cfg  *Config
+	head bool // Response to HEAD request, body is not sent
+
+	status  int          // Status passed to WriteHeader
+	buf     bytes.Buffer // Body written before decision
+	decided bool         // Whether headers are sent
+	hw      *huffman.Writer
+	err     error
+}
+
+func (cw *compressWriter) Header() http.Header {
+	return cw.w.Header()
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	if !cw.decided {
+		cw.buf.Write(p)
+		if cw.buf.Len() < cw.cfg.MinSize {
+			return len(p), nil
+		}
+		cw.decide(true)
+		return len(p), cw.err
+	}
+
+	if cw.head {
+		return len(p), nil
+	}
+	if cw.hw != nil {
+		_, cw.err = cw.hw.Write(p)
+	} else {
+		_, cw.err = cw.w.Write(p)
+	}
+	return len(p), cw.err
+}
+
+// Flush sends buffered body to client.
+// Size of flushed responses is unknown, so they are compressed if allowed.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.hw != nil && cw.err == nil {
+		cw.err = cw.hw.Flush()
+	}
+	if f, ok := cw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide sends headers and buffered body, compressing it if allowed and large enough.
+// Body which is not large is complete, so its length is known.
+func (cw *compressWriter) decide(large bool) {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.w.Header()
+	if h.Get("Content-Type") == "" && cw.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+	}
+
+	// Handler may answer HEAD with Content-Length of body it does not write
+	if cw.head && !large {
+		n, err := strconv.Atoi(h.Get("Content-Length"))
+		large = err == nil && n >= cw.cfg.MinSize
+	}
+
+	if large && cw.compressible() {
+		h.Set("Content-Encoding", Encoding)
+		h.Del("Content-Length")
+		cw.w.WriteHeader(cw.status)
+		if cw.head {
+			return
+		}
+		if cw.hw, cw.err = huffman.NewWriter(cw.w, cw.cfg.Options); cw.err == nil {
+			_, cw.err = cw.hw.Write(cw.buf.Bytes())
+		}
+	} else {
+		// Body of HEAD response may be omitted, then its Content-Length is kept
+		if !large && bodyAllowed(cw.status) && !(cw.head && cw.buf.Len() == 0) {
+			h.Set("Content-Length", strconv.Itoa(cw.buf.Len()))
+		}
+		cw.w.WriteHeader(cw.status)
+		_, cw.err = cw.w.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+}
+
+// compressible reports whether response may be compressed.
+func (cw *compressWriter) compressible() bool {
+	h := cw.w.Header()
+	if !bodyAllowed(cw.status) || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range cw.cfg.ContentTypes {
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyAllowed reports whether response with status may have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// close sends rest of the body when handler returns.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.decide(false)
+	}
+	if cw.hw != nil && cw.err == nil {
+		cw.err = cw.hw.Close()
+	}
+}
+
+// Transport advertises Encoding in requests without Accept-Encoding and
+// transparently decodes Huffman coded responses.
+type Transport struct {
+	Base http.RoundTripper // Underlying transport, nil means http.DefaultTransport
+
+	// MaxOutput limits size of decoded body, zero means no limit.
+	// Reading larger bodies fails with huffman.ErrTooLarge
+	MaxOutput int64
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// Leave requests which negotiate encoding themselves as they are
+	if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+		return base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", Encoding)
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), Encoding) {
+		resp.Body = &decodedBody{body: resp.Body, maxOutput: t.MaxOutput}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+
+	return resp, nil
+}
+
+// decodedBody decodes response body on first read.
+type decodedBody struct {
+	body      io.ReadCloser
+	maxOutput int64
+	hr        *huffman.Reader
+	err       error
+}
+
+func (db *decodedBody) Read(p []byte) (int, error) {
+	if db.hr == nil && db.err == nil {
+		db.hr, db.err = huffman.NewReaderWith(db.body, huffman.DecodeOptions{MaxOutput: db.maxOutput})
+	}
+	if db.err != nil {
+		return 0, db.err
+	}
+	return db.hr.Read(p)
+}
+
+func (db *decodedBody) Close() error {
+	return db.body.Close()
+}
@@ -0,0 +1,262 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/cravtos/huffman/internal/pkg/token"
+	"github.com/icza/bitio"
+)
+
+// Kinds of alphabet.
+const (
+	alphabetBytes   byte = iota // Every byte is a symbol
+	alphabetWords               // Every word or separator is a symbol
+	alphabetSamples             // Every sample of fixed width is a symbol
+)
+
+// alphabet describes how data is split into symbols.
+type alphabet struct {
+	kind byte
+	dict [][]byte // Tokens of words alphabet
+
+	// Samples alphabet
+	sampleWidth uint8     // Width of sample in bits
+	bigEndian   bool      // Byte order of samples
+	predictor   Predictor // Predictor used to get residuals
+	tail        []byte    // Bytes which do not form a whole sample
+	escape      bool      // Whether rare symbols are escaped
+	esc         uint32    // Escape symbol
+	escaped     []uint32  // Escaped symbols in order of appearance
+}
+
+// newAlphabet splits data into symbols according to options.
+func newAlphabet(data []byte, opts Options) (*alphabet, []uint32) {
+	if opts.Words {
+		dict, symbols := token.Tokenize(data)
+		return &alphabet{kind: alphabetWords, dict: dict}, symbols
+	}
+
+	if opts.Width != 0 {
+		a := &alphabet{
+			kind:        alphabetSamples,
+			sampleWidth: opts.Width,
+			bigEndian:   opts.BigEndian,
+			predictor:   opts.Predictor,
+		}
+
+		samples, tail := readSamples(data, a.sampleWidth, a.bigEndian)
+		a.tail = tail
+		symbols := a.predictor.residuals(samples, a.sampleWidth)
+
+		max := opts.Escape
+		if max == 0 {
+			max = DefaultEscape
+		}
+		a.esc, a.escaped = escapeRare(symbols, max)
+		a.escape = a.escaped != nil
+		return a, symbols
+	}
+
+	symbols := make([]uint32, len(data))
+	for i, v := range data {
+		symbols[i] = uint32(v)
+	}
+	return &alphabet{kind: alphabetBytes}, symbols
+}
+
+// width returns number of bits needed to write any symbol of alphabet.
+func (a *alphabet) width() uint8 {
+	if a.kind == alphabetWords {
+		if len(a.dict) < 2 {
+			return 1
+		}
+		return uint8(bits.Len32(uint32(len(a.dict) - 1)))
+	}
+	if a.kind == alphabetSamples {
+		return a.sampleWidth
+	}
+	return 8
+}
+
+// join converts symbols back to data not longer than limit.
+func (a *alphabet) join(symbols []uint32, limit int) ([]byte, error) {
+	if a.kind == alphabetWords {
+		return token.Join(a.dict, symbols, limit)
+	}
+
+	if a.kind == alphabetSamples {
+		if a.escape {
+			if err := unescape(symbols, a.esc, a.escaped); err != nil {
+				return nil, err
+			}
+		}
+		// Every sample takes several bytes, so size is checked before they are written
+		if size := len(symbols)*int(a.sampleWidth/8) + len(a.tail); size > limit {
+			return nil, fmt.Errorf("%d bytes of samples exceed limit of %d bytes", size, limit)
+		}
+		samples := a.predictor.samples(symbols, a.sampleWidth)
+		return writeSamples(samples, a.tail, a.sampleWidth, a.bigEndian), nil
+	}
+
+	data := make([]byte, len(symbols))
+	for i, s := range symbols {
+		if s > 0xff {
+			return nil, fmt.Errorf("symbol %d does not fit in a byte", s)
+		}
+		data[i] = byte(s)
+	}
+	return data, nil
+}
+
+// writeHeader writes alphabet kind and its parameters.
+//
+// Header: uint8 (alphabet kind)
+//
+// Words alphabet:
+//
+//	uint32 (number of tokens)
+//	uint16 (length of token) and token bytes for every token
+//
+// Samples alphabet:
+//
+//	uint8 (sample width), uint8 (1 if big endian), uint8 (predictor)
+//	uint8 (number of tail bytes) and tail bytes
+//	uint8 (1 if rare symbols are escaped), and if so:
+//	escape symbol, uint32 (number of escaped symbols) and escaped symbols
+func (a *alphabet) writeHeader(w *bitio.Writer) error {
+	w.TryWriteByte(a.kind)
+
+	switch a.kind {
+	case alphabetWords:
+		w.TryWriteBitsUnsafe(uint64(len(a.dict)), 32)
+		for _, t := range a.dict {
+			w.TryWriteBitsUnsafe(uint64(len(t)), 16)
+			w.TryWrite(t)
+		}
+	case alphabetSamples:
+		w.TryWriteByte(a.sampleWidth)
+		w.TryWriteBool(a.bigEndian)
+		w.TryWriteByte(byte(a.predictor))
+		w.TryWriteByte(byte(len(a.tail)))
+		w.TryWrite(a.tail)
+
+		w.TryWriteBool(a.escape)
+		if a.escape {
+			w.TryWriteBitsUnsafe(uint64(a.esc), a.sampleWidth)
+			w.TryWriteBitsUnsafe(uint64(len(a.escaped)), 32)
+			for _, s := range a.escaped {
+				w.TryWriteBitsUnsafe(uint64(s), a.sampleWidth)
+			}
+		}
+	}
+
+	return w.TryError
+}
+
+// readAlphabet reads header written by writeHeader of block
+// decoded to no more than limit bytes.
+func readAlphabet(r *bitio.Reader, limit int) (*alphabet, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &alphabet{kind: kind}
+	switch kind {
+	case alphabetBytes:
+	case alphabetWords:
+		u, err := r.ReadBits(32)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < u; i++ {
+			n, err := r.ReadBits(16)
+			if err != nil {
+				return nil, err
+			}
+			t := make([]byte, n)
+			if _, err = io.ReadFull(r, t); err != nil {
+				return nil, err
+			}
+			a.dict = append(a.dict, t)
+		}
+	case alphabetSamples:
+		if err := a.readSamplesHeader(r, limit); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown alphabet %d", kind)
+	}
+
+	return a, nil
+}
+
+// readSamplesHeader reads parameters of samples alphabet of block
+// decoded to no more than limit bytes.
+func (a *alphabet) readSamplesHeader(r *bitio.Reader, limit int) (err error) {
+	if a.sampleWidth, err = r.ReadByte(); err != nil {
+		return err
+	}
+	if !validWidth(a.sampleWidth) {
+		return fmt.Errorf("bad sample width %d", a.sampleWidth)
+	}
+
+	if a.bigEndian, err = r.ReadBool(); err != nil {
+		return err
+	}
+
+	p, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	a.predictor = Predictor(p)
+	if _, ok := predictorNames[a.predictor]; !ok {
+		return fmt.Errorf("unknown predictor %d", p)
+	}
+
+	n, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if n >= a.sampleWidth/8 {
+		return fmt.Errorf("too many tail bytes: %d", n)
+	}
+	a.tail = make([]byte, n)
+	if _, err = io.ReadFull(r, a.tail); err != nil {
+		return err
+	}
+
+	if a.escape, err = r.ReadBool(); err != nil || !a.escape {
+		return err
+	}
+
+	u, err := r.ReadBits(a.sampleWidth)
+	if err != nil {
+		return err
+	}
+	a.esc = uint32(u)
+
+	if u, err = r.ReadBits(32); err != nil {
+		return err
+	}
+	// Every escaped value is a sample of decoded data
+	if u > uint64(limit/int(a.sampleWidth/8)) {
+		return fmt.Errorf("%d escaped samples exceed limit of %d bytes", u, limit)
+	}
+	for i := uint64(0); i < u; i++ {
+		s, err := r.ReadBits(a.sampleWidth)
+		if err != nil {
+			return err
+		}
+		a.escaped = append(a.escaped, uint32(s))
+	}
+
+	return nil
+}
+
+// validWidth reports whether samples can be width bits wide.
+func validWidth(width uint8) bool {
+	return width == 8 || width == 16 || width == 32
+}
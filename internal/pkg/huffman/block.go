@@ -0,0 +1,448 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cravtos/huffman/internal/pkg/arith"
+	"github.com/cravtos/huffman/internal/pkg/code"
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+	"github.com/cravtos/huffman/internal/pkg/model"
+	"github.com/cravtos/huffman/internal/pkg/rans"
+	"github.com/cravtos/huffman/internal/pkg/rle"
+	"github.com/cravtos/huffman/internal/pkg/tree"
+	"github.com/icza/bitio"
+)
+
+// nStreams is the number of streams used by MethodInterleaved.
+const nStreams = 4
+
+// encodeBlock encodes data as a self-contained block using given options.
+// Data is modified by filters.
+//
+// The method, filters and alphabet are written in front of the header, so decodeBlock does not need them.
+func encodeBlock(data []byte, opts Options) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	w := bitio.NewWriter(&buf)
+
+	// Apply filters
+	filters := applyFilters(data, opts.Filters)
+
+	// Split data into symbols
+	a, symbols := newAlphabet(data, opts)
+	width := a.width()
+
+	// Collapse runs into symbols following the alphabet
+	useRuns := opts.Runs.useRuns(symbols, width)
+	var runs []rle.Run
+	if useRuns {
+		symbols, runs = rle.Encode(symbols, 1<<width)
+		width = runsWidth(width)
+	}
+
+	// Calculate symbol frequencies
+	freq := helpers.CalcSymbolFreq(symbols)
+
+	// Write method, filters, alphabet and encoded data
+	w.TryWriteByte(byte(opts.Method))
+	if err = writeFilters(w, filters); err != nil {
+		return nil, err
+	}
+	if err = a.writeHeader(w); err != nil {
+		return nil, err
+	}
+	w.TryWriteBool(useRuns)
+
+	switch opts.Method {
+	case MethodHuffman, MethodInterleaved:
+		err = encodeHuffman(w, freq, symbols, width, opts)
+	case MethodArithmetic, MethodRANS:
+		err = encodeModel(w, freq, symbols, width, opts.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Write lengths of runs
+	if err = writeRuns(w, runs); err != nil {
+		return nil, err
+	}
+
+	if w.TryError != nil {
+		return nil, w.TryError
+	}
+
+	// Flush everything to buffer
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeHuffman writes header format, encoding tree and Huffman codes of symbols.
+func encodeHuffman(w *bitio.Writer, freq map[uint32]uint, symbols []uint32, width uint8, opts Options) error {
+	// Construct encoding tree
+	root, err := tree.NewLimitedTree(freq, opts.maxCodeLen())
+	if err != nil {
+		return err
+	}
+
+	// Write header information
+	w.TryWriteByte(byte(opts.Header))
+	if opts.Header == HeaderCanonical {
+		if root, err = tree.NewCanonicalTree(root.CodeLengths()); err != nil {
+			return err
+		}
+		err = root.WriteCanonicalHeader(w, freq, width)
+	} else {
+		err = root.WriteHeader(w, freq, width)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Make encoding table
+	table := root.NewEncodingTable()
+
+	if opts.Method == MethodInterleaved {
+		return writeInterleaved(w, table, symbols)
+	}
+
+	writeCodes(w, table, symbols)
+	return w.TryError
+}
+
+// encodeModel writes scaled frequencies and symbols coded by arithmetic or rANS coder.
+//
+// Layout: uint32 (number of encoded symbols)
+//
+//	model header (see model.WriteHeader)
+//	uint32 (size of coded data in bytes), byte aligned
+//	coded data
+func encodeModel(w *bitio.Writer, freq map[uint32]uint, symbols []uint32, width uint8, method Method) error {
+	m, err := model.New(freq)
+	if err != nil {
+		return err
+	}
+
+	w.TryWriteBitsUnsafe(uint64(len(symbols)), 32)
+	if err := m.WriteHeader(w, width); err != nil {
+		return err
+	}
+
+	var coded []byte
+	if method == MethodArithmetic {
+		var buf bytes.Buffer
+		aw := bitio.NewWriter(&buf)
+		if err := arith.Encode(aw, m, symbols); err != nil {
+			return err
+		}
+		if err := aw.Close(); err != nil {
+			return err
+		}
+		coded = buf.Bytes()
+	} else {
+		coded = rans.Encode(m, symbols)
+	}
+
+	w.TryAlign()
+	w.TryWriteBitsUnsafe(uint64(len(coded)), 32)
+	w.TryWrite(coded)
+	return w.TryError
+}
+
+// writeCodes writes code of every symbol.
+func writeCodes(w *bitio.Writer, table code.Table, symbols []uint32) {
+	for _, v := range symbols {
+		w.TryWriteBitsUnsafe(table[v].Code, table[v].Len)
+	}
+}
+
+// writeInterleaved splits symbols into nStreams parts and encodes each of them
+// into a separate byte aligned stream.
+//
+// Layout:
+//
+//	nStreams * uint32 (size of each stream in bytes)
+//	streams one after another
+//
+// Stream i holds symbols [i*q, (i+1)*q), where q = ceil(nEncoded / nStreams).
+func writeInterleaved(w *bitio.Writer, table code.Table, symbols []uint32) error {
+	var streams [nStreams]bytes.Buffer
+
+	for i := range streams {
+		lo, hi := streamBounds(i, len(symbols))
+		sw := bitio.NewWriter(&streams[i])
+		writeCodes(sw, table, symbols[lo:hi])
+		if sw.TryError != nil {
+			return sw.TryError
+		}
+		if err := sw.Close(); err != nil {
+			return err
+		}
+	}
+
+	// Write jump table
+	w.TryAlign()
+	for i := range streams {
+		w.TryWriteBitsUnsafe(uint64(streams[i].Len()), 32)
+	}
+
+	for i := range streams {
+		w.TryWrite(streams[i].Bytes())
+	}
+
+	return w.TryError
+}
+
+// streamBounds returns range of symbols held by i-th stream of interleaved data.
+func streamBounds(i, n int) (lo, hi int) {
+	q := (n + nStreams - 1) / nStreams
+	lo, hi = i*q, (i+1)*q
+	if lo > n {
+		lo = n
+	}
+	if hi > n {
+		hi = n
+	}
+	return lo, hi
+}
+
+// decodeBlock decodes block written by encodeBlock.
+// Every symbol stands for at least one byte of data, so neither number of symbols
+// nor size of decoded data may exceed limit.
+func decodeBlock(block []byte, limit int) ([]byte, error) {
+	r := bitio.NewReader(bytes.NewReader(block))
+
+	// Read method used to encode data
+	method, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read filters applied to data
+	filters, err := readFilters(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read alphabet used to split data into symbols
+	a, err := readAlphabet(r, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read whether runs are collapsed
+	useRuns, err := r.ReadBool()
+	if err != nil {
+		return nil, err
+	}
+	width := a.width()
+	if useRuns {
+		width = runsWidth(width)
+	}
+
+	var symbols []uint32
+	switch Method(method) {
+	case MethodHuffman, MethodInterleaved:
+		symbols, err = decodeHuffman(r, width, Method(method), limit)
+	case MethodArithmetic, MethodRANS:
+		symbols, err = decodeModel(r, width, Method(method), limit)
+	default:
+		err = fmt.Errorf("unknown method %d", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand runs
+	if useRuns {
+		if symbols, err = readRuns(r, symbols, 1<<a.width(), limit); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := a.join(symbols, limit)
+	if err != nil {
+		return nil, err
+	}
+	revertFilters(data, filters)
+
+	return data, nil
+}
+
+// decodeHuffman reads encoding tree and decodes symbols written by encodeHuffman.
+func decodeHuffman(r *bitio.Reader, width uint8, method Method, limit int) ([]uint32, error) {
+	format, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read header and construct encoding tree
+	var nEncoded uint32
+	var root *tree.Node
+	switch HeaderFormat(format) {
+	case HeaderTree:
+		nEncoded, root, err = tree.DecodeHeader(r, width)
+	case HeaderCanonical:
+		nEncoded, root, err = tree.DecodeCanonicalHeader(r, width)
+	default:
+		err = fmt.Errorf("unknown header format %d", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSymbols(nEncoded, root != nil, limit); err != nil {
+		return nil, err
+	}
+
+	if method == MethodInterleaved {
+		return readInterleaved(r, root, nEncoded)
+	}
+	return readCodes(r, root, nEncoded)
+}
+
+// decodeModel reads model and decodes symbols written by encodeModel.
+func decodeModel(r *bitio.Reader, width uint8, method Method, limit int) ([]uint32, error) {
+	u, err := r.ReadBits(32)
+	if err != nil {
+		return nil, err
+	}
+	nEncoded := int(u)
+
+	m, err := model.ReadModel(r, width)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSymbols(uint32(nEncoded), m.Len() != 0, limit); err != nil {
+		return nil, err
+	}
+
+	r.Align()
+	if u, err = r.ReadBits(32); err != nil {
+		return nil, err
+	}
+	coded, err := readBytes(r, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if method == MethodArithmetic {
+		return arith.Decode(bitio.NewReader(bytes.NewReader(coded)), m, nEncoded)
+	}
+	return rans.Decode(coded, m, nEncoded)
+}
+
+// readCodes decodes nEncoded symbols from r.
+func readCodes(r *bitio.Reader, root *tree.Node, nEncoded uint32) ([]uint32, error) {
+	// nEncoded comes from untrusted header, so memory grows as symbols are decoded
+	size := nEncoded
+	if size > 1<<16 {
+		size = 1 << 16
+	}
+	symbols := make([]uint32, 0, size)
+
+	// Decoding file code by code
+	var i uint32
+	for ; i != nEncoded; i++ {
+		s, err := root.DecodeNext(r)
+		if err != nil {
+			break
+		}
+		symbols = append(symbols, s)
+	}
+
+	// Check if number of decoded symbols equal number of symbols in header
+	if i != nEncoded {
+		errMsg := fmt.Sprintf("number of decoded symbols not equal to number of symbols from header: %d != %d\n", i, nEncoded)
+		return nil, errors.New(errMsg)
+	}
+
+	return symbols, nil
+}
+
+// readInterleaved reads streams written by writeInterleaved and decodes them
+// taking one symbol from each stream in turn.
+func readInterleaved(r *bitio.Reader, root *tree.Node, nEncoded uint32) ([]uint32, error) {
+	r.Align()
+
+	// Read jump table
+	var sizes [nStreams]uint32
+	for i := range sizes {
+		u, err := r.ReadBits(32)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = uint32(u)
+	}
+
+	n := int(nEncoded)
+	var readers [nStreams]*tree.BitReader
+	var lo, hi [nStreams]int
+	for i := range readers {
+		lo[i], hi[i] = streamBounds(i, n)
+		buf, err := readBytes(r, uint64(sizes[i]))
+		if err != nil {
+			return nil, err
+		}
+		readers[i] = tree.NewBitReader(buf)
+	}
+
+	// Every symbol takes at least one bit unless the tree has a single leaf
+	var total uint64
+	for _, size := range sizes {
+		total += uint64(size)
+	}
+	if !root.IsLeaf() && uint64(n) > 8*total {
+		return nil, fmt.Errorf("%d symbols do not fit streams of %d bytes", n, total)
+	}
+
+	// Codes are looked up in a table, so the streams are decoded
+	// without waiting for each other bit by bit
+	d := root.NewDecoder()
+	symbols := make([]uint32, n)
+	for k := 0; k < hi[0]; k++ {
+		for i := range readers {
+			if lo[i]+k >= hi[i] {
+				continue
+			}
+
+			s, err := d.Next(readers[i])
+			if err != nil {
+				return nil, fmt.Errorf("stream %d: symbol %d: %v", i, k, err)
+			}
+			symbols[lo[i]+k] = s
+		}
+	}
+
+	return symbols, nil
+}
+
+// checkSymbols checks number of encoded symbols against size of block data
+// before anything is allocated for them.
+func checkSymbols(nEncoded uint32, hasCodes bool, limit int) error {
+	if uint64(nEncoded) > uint64(limit) {
+		return fmt.Errorf("%d symbols do not fit block of %d bytes", nEncoded, limit)
+	}
+	if nEncoded != 0 && !hasCodes {
+		return errors.New("no codes for non-empty data")
+	}
+	return nil
+}
+
+// readBytes reads n bytes from r. Memory grows as data is read,
+// so a corrupted size does not cause a huge allocation.
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
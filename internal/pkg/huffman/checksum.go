@@ -0,0 +1,69 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/crc64"
+)
+
+// Checksum selects checksum of decoded data stored after every block.
+type Checksum byte
+
+const (
+	// ChecksumCRC32 stores CRC-32 (IEEE) of every block.
+	ChecksumCRC32 Checksum = iota
+	// ChecksumNone stores no checksums.
+	ChecksumNone
+	// ChecksumCRC64 stores CRC-64 (ECMA) of every block.
+	ChecksumCRC64
+)
+
+var checksumNames = map[Checksum]string{
+	ChecksumCRC32: "crc32",
+	ChecksumNone:  "none",
+	ChecksumCRC64: "crc64",
+}
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// String returns checksum name.
+func (c Checksum) String() string {
+	if name, ok := checksumNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("checksum(%d)", byte(c))
+}
+
+// ParseChecksum returns checksum by its name.
+func ParseChecksum(name string) (Checksum, error) {
+	for c, n := range checksumNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown checksum %q", name)
+}
+
+// size returns size of checksum in bytes.
+func (c Checksum) size() int {
+	switch c {
+	case ChecksumCRC32:
+		return 4
+	case ChecksumCRC64:
+		return 8
+	}
+	return 0
+}
+
+// sum appends checksum of data to b.
+func (c Checksum) sum(b, data []byte) []byte {
+	var buf [8]byte
+	switch c {
+	case ChecksumCRC32:
+		binary.BigEndian.PutUint32(buf[:], crc32.ChecksumIEEE(data))
+	case ChecksumCRC64:
+		binary.BigEndian.PutUint64(buf[:], crc64.Checksum(data, crc64Table))
+	}
+	return append(b, buf[:c.size()]...)
+}
@@ -0,0 +1,82 @@
+package huffman
+
+import (
+	"errors"
+
+	"github.com/cravtos/huffman/internal/pkg/filter"
+	"github.com/icza/bitio"
+)
+
+// maxFilters is the maximum number of filters applied to data.
+const maxFilters = 255
+
+// applyFilters applies filters to data in place, replacing automatic filter with chosen one.
+// Returns filters which were applied.
+func applyFilters(data []byte, filters []filter.Filter) []filter.Filter {
+	applied := make([]filter.Filter, 0, len(filters))
+
+	for _, f := range filters {
+		if f.Kind == filter.Auto {
+			f = filter.Choose(data)
+		}
+		if f.Kind == filter.None {
+			continue
+		}
+
+		f.Encode(data)
+		applied = append(applied, f)
+	}
+
+	return applied
+}
+
+// revertFilters reverts filters applied to data in reverse order.
+func revertFilters(data []byte, filters []filter.Filter) {
+	for i := len(filters) - 1; i >= 0; i-- {
+		filters[i].Decode(data)
+	}
+}
+
+// writeFilters writes list of applied filters.
+//
+// Header: uint8 (number of filters)
+//
+//	uint8 (filter kind) and uint32 (filter parameter) for every filter
+func writeFilters(w *bitio.Writer, filters []filter.Filter) error {
+	w.TryWriteByte(byte(len(filters)))
+	for _, f := range filters {
+		w.TryWriteByte(byte(f.Kind))
+		w.TryWriteBitsUnsafe(uint64(f.Param), 32)
+	}
+	return w.TryError
+}
+
+// readFilters reads list of filters written by writeFilters.
+func readFilters(r *bitio.Reader) ([]filter.Filter, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make([]filter.Filter, n)
+	for i := range filters {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		param, err := r.ReadBits(32)
+		if err != nil {
+			return nil, err
+		}
+
+		filters[i] = filter.Filter{Kind: filter.Kind(kind), Param: uint32(param)}
+		if filters[i].Kind == filter.Auto {
+			return nil, errors.New("automatic filter in header")
+		}
+		if err = filters[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return filters, nil
+}
@@ -0,0 +1,256 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/cravtos/huffman/internal/pkg/crypt"
+)
+
+// Frame layout, in front of every block and at the end of blocks:
+//
+//	sync marker, uint64 (offset of block data)    only with sync markers
+//	uint8 (blockData or blockEnd)
+//	uint32 (size of data), uint32 (size of block) only for blockData
+//	uint32 (CRC-32 of the above after marker)     only with sync markers
+//	block, checksum of data                       only for blockData
+//
+// Sync markers let damaged streams be scanned for the next intact block,
+// and the offset tells where its data belongs.
+const (
+	syncMarker = "\xa5HUFSYNC"
+
+	// flagSync is set in the stream header byte when sync markers are used.
+	flagSync = 0x80
+
+	syncHeaderSize = 8 + 8 + 4
+)
+
+// errEncrypted is returned when encrypted stream is read other than sequentially.
+var errEncrypted = errors.New("huffman: encrypted stream can be decoded only sequentially")
+
+// streamHeader holds parameters stored after stream magic.
+type streamHeader struct {
+	checksum Checksum // Checksum of data of every block
+	sync     bool     // Frames start with sync markers
+	meta     bool     // Metadata follows header byte
+	metaSize int      // Size of metadata, known once it is read
+}
+
+// frameHeader is a header of block or of the end of blocks.
+type frameHeader struct {
+	end       bool   // No more blocks
+	offset    uint64 // Offset of block data, or size of data at the end
+	dataSize  uint32
+	blockSize uint32
+}
+
+// encode returns stream header byte.
+func (h streamHeader) encode() byte {
+	b := byte(h.checksum)
+	if h.sync {
+		b |= flagSync
+	}
+	if h.meta {
+		b |= flagMeta
+	}
+	return b
+}
+
+// size returns size of stream header including metadata.
+func (h streamHeader) size() int64 {
+	return streamHeaderSize + int64(h.metaSize)
+}
+
+// readStreamHeader reads header of stream starting at given offset,
+// skipping its metadata.
+func readStreamHeader(r io.ReaderAt, offset int64) (streamHeader, error) {
+	head := make([]byte, streamHeaderSize)
+	if _, err := r.ReadAt(head, offset); err != nil {
+		return streamHeader{}, err
+	}
+	h, err := parseStreamHeader(head)
+	if err != nil || !h.meta {
+		return h, err
+	}
+	_, h.metaSize, err = readMetadata(io.NewSectionReader(r, offset+streamHeaderSize, maxMetaSize+4))
+	return h, err
+}
+
+// parseStreamHeader checks magic and returns parameters of stream.
+func parseStreamHeader(head []byte) (streamHeader, error) {
+	if crypt.Detect(head) {
+		return streamHeader{}, errEncrypted
+	}
+	if string(head[:len(magic)]) != magic {
+		return streamHeader{}, errors.New("not a huffman stream")
+	}
+
+	b := head[len(magic)]
+	h := streamHeader{
+		checksum: Checksum(b &^ (flagSync | flagMeta)),
+		sync:     b&flagSync != 0,
+		meta:     b&flagMeta != 0,
+	}
+	if _, ok := checksumNames[h.checksum]; !ok {
+		return streamHeader{}, fmt.Errorf("unknown checksum %d", h.checksum)
+	}
+	return h, nil
+}
+
+// frameSize returns size of frame header.
+func (h streamHeader) frameSize(end bool) int {
+	n := blockHeaderSize
+	if end {
+		n = 1
+	}
+	if h.sync {
+		n += syncHeaderSize
+	}
+	return n
+}
+
+// appendFrame appends frame header to b.
+func (h streamHeader) appendFrame(b []byte, fh frameHeader) []byte {
+	if h.sync {
+		b = append(b, syncMarker...)
+	}
+	start := len(b)
+
+	if h.sync {
+		b = appendUint64(b, fh.offset)
+	}
+	if fh.end {
+		b = append(b, blockEnd)
+	} else {
+		b = append(b, blockData)
+		b = appendUint32(b, fh.dataSize)
+		b = appendUint32(b, fh.blockSize)
+	}
+
+	if h.sync {
+		b = appendUint32(b, crc32.ChecksumIEEE(b[start:]))
+	}
+	return b
+}
+
+// readFrame reads frame header from r.
+func (h streamHeader) readFrame(r io.Reader) (fh frameHeader, err error) {
+	buf := make([]byte, 0, h.frameSize(false))
+	read := func(n int) ([]byte, error) {
+		start := len(buf)
+		buf = buf[:start+n]
+		_, err := io.ReadFull(r, buf[start:])
+		return buf[start:], err
+	}
+
+	var b []byte
+	if h.sync {
+		if b, err = read(len(syncMarker)); err != nil {
+			return fh, err
+		}
+		if string(b) != syncMarker {
+			return fh, errors.New("sync marker is missing")
+		}
+		buf = buf[:0]
+
+		if b, err = read(8); err != nil {
+			return fh, err
+		}
+		fh.offset = binary.BigEndian.Uint64(b)
+	}
+
+	if b, err = read(1); err != nil {
+		return fh, err
+	}
+	switch b[0] {
+	case blockEnd:
+		fh.end = true
+	case blockData:
+		if b, err = read(8); err != nil {
+			return fh, err
+		}
+		fh.dataSize = binary.BigEndian.Uint32(b)
+		fh.blockSize = binary.BigEndian.Uint32(b[4:])
+	default:
+		return fh, fmt.Errorf("unknown block type %d", b[0])
+	}
+
+	if h.sync {
+		sum := crc32.ChecksumIEEE(buf)
+		if b, err = read(4); err != nil {
+			return fh, err
+		}
+		if binary.BigEndian.Uint32(b) != sum {
+			return fh, errors.New("block header checksum mismatch")
+		}
+	}
+
+	if fh.dataSize > MaxBlockSize {
+		return fh, fmt.Errorf("block data is too large: %d", fh.dataSize)
+	}
+	return fh, nil
+}
+
+// readPayload reads block following fh and checksum of its data,
+// and decodes the block.
+func (h streamHeader) readPayload(r io.Reader, fh frameHeader) ([]byte, error) {
+	block, err := readBytes(r, uint64(fh.blockSize)+uint64(h.checksum.size()))
+	if err != nil {
+		return nil, err
+	}
+	sum := block[fh.blockSize:]
+	block = block[:fh.blockSize]
+
+	data, err := decodeBlock(block, int(fh.dataSize))
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(data)) != fh.dataSize {
+		return nil, fmt.Errorf("decoded %d bytes instead of %d", len(data), fh.dataSize)
+	}
+	if !bytes.Equal(h.checksum.sum(nil, data), sum) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// readBlock reads and decodes next block from r, which data starts at offset.
+// Returns end set to true when there are no more blocks.
+// Blocks holding more than maxData bytes are rejected before decoding.
+func (h streamHeader) readBlock(r io.Reader, offset, maxData uint64) (data []byte, end bool, err error) {
+	fh, err := h.readFrame(r)
+	if err != nil {
+		return nil, false, err
+	}
+	if h.sync && fh.offset != offset {
+		return nil, false, fmt.Errorf("block is at offset %d instead of %d", fh.offset, offset)
+	}
+	if fh.end {
+		return nil, true, nil
+	}
+	if uint64(fh.dataSize) > maxData {
+		return nil, false, ErrTooLarge
+	}
+
+	data, err = h.readPayload(r, fh)
+	return data, false, err
+}
+
+// appendUint32 appends big endian v to b.
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendUint64 appends big endian v to b.
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,37 @@
+package huffman
+
+import "fmt"
+
+// HeaderFormat selects how Huffman codes are stored in front of coded data.
+type HeaderFormat byte
+
+const (
+	// HeaderTree stores shape of the encoding tree with symbols in its leaves.
+	HeaderTree HeaderFormat = iota
+	// HeaderCanonical stores number of codes of every length and symbols
+	// in canonical order. It is smaller for byte alphabets.
+	HeaderCanonical
+)
+
+var headerFormatNames = map[HeaderFormat]string{
+	HeaderTree:      "tree",
+	HeaderCanonical: "canonical",
+}
+
+// String returns header format name.
+func (f HeaderFormat) String() string {
+	if name, ok := headerFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("header(%d)", byte(f))
+}
+
+// ParseHeaderFormat returns header format by its name.
+func ParseHeaderFormat(name string) (HeaderFormat, error) {
+	for f, n := range headerFormatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown header format %q", name)
+}
@@ -1,85 +1,196 @@
 package huffman
 
 import (
-	"bufio"
+	"context"
 	"errors"
-	"fmt"
+	"io"
 	"os"
 
-	"github.com/cravtos/huffman/internal/pkg/helpers"
-	"github.com/cravtos/huffman/internal/pkg/tree"
-	"github.com/icza/bitio"
+	"github.com/cravtos/huffman/internal/pkg/crypt"
+	"github.com/cravtos/huffman/internal/pkg/sign"
 )
 
-// Encode do huffman encoding of os.File to os.File.
-func Encode(in *os.File, out *os.File) (err error) {
-	r := bufio.NewReader(in)
-	w := bitio.NewWriter(out)
+// Stream layout:
+//
+//	magic
+//	uint8 (checksum type, flagSync, flagMeta)
+//	metadata, only with flagMeta (see Metadata layout)
+//	blocks, each: uint8 (blockData), uint32 (size of data), uint32 (size of block), block, checksum of data
+//	uint8 (blockEnd)
+//	index: uint64 (data offset) and uint64 (stream offset) of every block
+//	footer: uint64 (data size), uint32 (number of blocks), indexMagic
+//
+// Every block is coded independently, so the index allows decoding any block
+// without decoding preceding ones. With flagSync set, block headers and
+// end of blocks are extended by sync markers (see Frame layout).
+// With Options.Secret the whole stream is encrypted (see package crypt),
+// and with Options.Parity it is wrapped in parity stream (see package parity).
+//
+// Streams may be concatenated, and such members are decoded one after another
+// as one stream. Member with parity has no end, so it may only be the last one.
+const (
+	magic      = "HUF1"
+	indexMagic = "HUFX"
+
+	streamHeaderSize = 4 + 1
+
+	blockEnd  byte = 0
+	blockData byte = 1
+
+	blockHeaderSize = 1 + 4 + 4
+	indexEntrySize  = 8 + 8
+	footerSize      = 8 + 4 + 4
+)
+
+// indexEntry holds position of block in original data and in stream.
+type indexEntry struct {
+	dataOffset   uint64
+	streamOffset uint64
+}
 
-	// Calculate byte frequencies
-	freq := helpers.CalcFreq(r)
+// Encode do huffman encoding of in to out using default options.
+func Encode(in io.Reader, out io.Writer) (err error) {
+	return EncodeWith(in, out, Options{})
+}
 
-	// Construct encoding tree
-	root := tree.NewEncodingTree(freq)
+// EncodeWith do huffman encoding of in to out using given options.
+//
+// Data is split into blocks, each coded independently,
+// followed by index of blocks (see Stream layout).
+func EncodeWith(in io.Reader, out io.Writer, opts Options) (err error) {
+	return EncodeContext(context.Background(), in, out, opts)
+}
 
-	// Write header information
-	if err = root.WriteHeader(w, freq); err != nil {
+// EncodeContext is like EncodeWith, but stops with ctx.Err() if ctx is done
+// before all blocks are encoded.
+func EncodeContext(ctx context.Context, in io.Reader, out io.Writer, opts Options) (err error) {
+	w, err := NewWriter(out, opts)
+	if err != nil {
 		return err
 	}
+	w.total = inputSize(in)
+
+	// Read data block by block, so ctx is checked between blocks
+	buf := make([]byte, opts.blockSize())
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := io.ReadFull(in, buf)
+		if _, werr := w.Write(buf[:n]); werr != nil {
+			return werr
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-	// Make encoding table
-	table := root.NewEncodingTable()
+	// Flush everything to file
+	return w.Close()
+}
 
-	// Start reading from beginning
-	if _, err = in.Seek(0, 0); err != nil {
-		return err
+// CanAppend checks whether stream of given size may be followed by another member.
+// Empty stream may be appended to. Otherwise stream must end with index of blocks,
+// so stream which ends with member with parity or encrypted member, or is signed,
+// can not be appended to.
+func CanAppend(r io.ReaderAt, size int64) error {
+	if size == 0 {
+		return nil
 	}
-	r.Reset(in)
 
-	// Encode file
-	v, err := r.ReadByte()
-	for err == nil {
-		w.TryWriteBitsUnsafe(table[v].Code, table[v].Len)
-		v, err = r.ReadByte()
+	_, trailer, err := sign.Split(r, size)
+	if err != nil {
+		return err
+	}
+	if trailer != nil {
+		return errors.New("stream is signed, appending would break its signature")
 	}
 
-	if w.TryError != nil {
-		return w.TryError
+	if size < streamHeaderSize+1+footerSize {
+		return errors.New("stream is too short")
+	}
+	head := make([]byte, len(magic))
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return err
+	}
+	if string(head) != magic && !crypt.Detect(head) {
+		return errors.New("not a stream, or stream with parity")
 	}
 
-	// Close writer and flush everything to file
-	return w.Close()
+	tail := make([]byte, len(indexMagic))
+	if _, err := r.ReadAt(tail, size-int64(len(indexMagic))); err != nil {
+		return err
+	}
+	if string(tail) != indexMagic {
+		return errors.New("stream does not end with index, it may be encrypted or truncated")
+	}
+	return nil
 }
 
-// Decode do huffman decoding of os.File to os.File.
-func Decode(in *os.File, out *os.File) (err error) {
-	r := bitio.NewReader(in)
-	w := bitio.NewWriter(out)
+// Decode do huffman decoding of in to out.
+// Blocks are decoded one by one, so in is read sequentially.
+func Decode(in io.Reader, out io.Writer) (err error) {
+	return DecodeContext(context.Background(), in, out, DecodeOptions{})
+}
 
-	// Read header and construct encoding tree
-	nEncoded, root, err := tree.DecodeHeader(r)
+// DecodeContext is like Decode, but stops with ctx.Err() if ctx is done
+// before all data is decoded.
+func DecodeContext(ctx context.Context, in io.Reader, out io.Writer, opts DecodeOptions) (err error) {
+	r, err := NewReaderWith(in, opts)
 	if err != nil {
 		return err
 	}
+	return r.DecodeTo(ctx, out)
+}
 
-	// Decoding file code by code
-	var i uint32
-	code, err := root.DecodeNext(r)
-	for i = 0; i != nEncoded && err == nil; i++ {
-		w.TryWriteByte(code)
-		code, err = root.DecodeNext(r)
-	}
-
-	if w.TryError != nil {
-		return w.TryError
+// DecodeTo decodes the rest of stream to out, reporting progress and
+// corrected symbols as set in DecodeOptions. It stops with ctx.Err()
+// if ctx is done before all data is decoded.
+func (hr *Reader) DecodeTo(ctx context.Context, out io.Writer) error {
+	buf := make([]byte, 32*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := hr.Read(buf)
+		if _, werr := out.Write(buf[:n]); werr != nil {
+			return werr
+		}
+		if hr.progress != nil && (n > 0 || err == io.EOF) {
+			hr.progress(hr.consumed(), hr.total)
+		}
+		if err == io.EOF {
+			if hr.corrected != nil && hr.parity != nil {
+				hr.corrected(hr.Corrected())
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
+}
 
-	// Check if number of decoded symbols equal number of symbols in header
-	if i != nEncoded {
-		errMsg := fmt.Sprintf("number of decoded symbols not equal to number of symbols from header: %d != %d\n", i, nEncoded)
-		return errors.New(errMsg)
+// inputSize returns amount of data left in r, or -1 if it is unknown.
+func inputSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
 	}
-
-	// Flush everything to file
-	return w.Close()
+	return -1
 }
@@ -0,0 +1,302 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metadata layout, following stream header byte with flagMeta:
+//
+//	uint32 (size of the rest)
+//	uint8 (metaMode, metaModTime, metaOwner flags)
+//	uint16 (name length), name, uint32 (mode), int64 (mtime in unix nanoseconds)
+//	uint32 (uid), uint32 (gid)
+//	uint16 (number of xattrs), each: uint16 (name length), name, uint32 (value length), value
+//	uint32 (CRC-32 of the above after size)
+const (
+	// flagMeta is set in the stream header byte when metadata follows it.
+	flagMeta = 0x40
+
+	metaMode    = 1 << 0
+	metaModTime = 1 << 1
+	metaOwner   = 1 << 2
+
+	// maxMetaSize limits metadata read from stream.
+	maxMetaSize = 1 << 20
+)
+
+// metaModeMask selects file mode bits stored in metadata.
+const metaModeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// Metadata describes file encoded in stream. Only fields which are set are stored.
+type Metadata struct {
+	Name    string      // Base name of file
+	Mode    os.FileMode // Permission bits, stored if HasMode is set
+	HasMode bool
+	ModTime time.Time // Modification time, stored if not zero
+
+	// Owner, stored if HasOwner is set
+	UID, GID int
+	HasOwner bool
+
+	// Extended attributes, stored if not empty
+	Xattrs map[string][]byte
+}
+
+// FileMetadata returns metadata of named file: its base name, mode and modification time.
+// Owner and extended attributes are added if owner and xattrs are set
+// and the system supports them.
+func FileMetadata(name string, owner, xattrs bool) (*Metadata, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{
+		Name:    filepath.Base(name),
+		Mode:    info.Mode() & metaModeMask,
+		HasMode: true,
+		ModTime: info.ModTime(),
+	}
+	if owner {
+		m.UID, m.GID, m.HasOwner = fileOwner(info)
+	}
+	if xattrs {
+		if m.Xattrs, err = readXattrs(name); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Apply restores mode and modification time of named file.
+// Since stream may come from anyone, owner, extended attributes and
+// setuid, setgid and sticky bits are restored only if owner, xattrs
+// and special are set. Owner is not restored if the process is not
+// permitted to change it.
+func (m *Metadata) Apply(name string, owner, xattrs, special bool) error {
+	// Owner is changed first, since it clears setuid and setgid bits
+	if owner && m.HasOwner {
+		if err := setOwner(name, m.UID, m.GID); err != nil {
+			return err
+		}
+	}
+	if m.HasMode {
+		mode := m.Mode
+		if !special {
+			mode &= os.ModePerm
+		}
+		if err := os.Chmod(name, mode); err != nil {
+			return err
+		}
+	}
+	if xattrs && len(m.Xattrs) > 0 {
+		if err := writeXattrs(name, m.Xattrs); err != nil {
+			return err
+		}
+	}
+	if !m.ModTime.IsZero() {
+		if err := os.Chtimes(name, m.ModTime, m.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckName returns error if name is not a plain file name,
+// so it can be used to create file in the current directory.
+func CheckName(name string) error {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return fmt.Errorf("bad file name %q", name)
+	case strings.ContainsAny(name, "/\\\x00"):
+		return fmt.Errorf("file name %q is not a base name", name)
+	}
+	return nil
+}
+
+// validate checks whether metadata can be stored.
+func (m *Metadata) validate() error {
+	if m.Name != "" {
+		if err := CheckName(m.Name); err != nil {
+			return err
+		}
+	}
+	if len(m.Name) > 1<<16-1 {
+		return errors.New("file name is too long")
+	}
+	if len(m.Xattrs) > 1<<16-1 {
+		return errors.New("too many extended attributes")
+	}
+	for name := range m.Xattrs {
+		if name == "" || len(name) > 1<<16-1 {
+			return fmt.Errorf("bad extended attribute name %q", name)
+		}
+	}
+	if m.HasOwner && (m.UID < 0 || m.GID < 0 || uint64(m.UID) > 1<<32-1 || uint64(m.GID) > 1<<32-1) {
+		return fmt.Errorf("bad owner %d:%d", m.UID, m.GID)
+	}
+	if len(m.encode()) > maxMetaSize {
+		return errors.New("metadata is too large")
+	}
+	return nil
+}
+
+// encode returns metadata as it is stored in stream.
+func (m *Metadata) encode() []byte {
+	var flags byte
+	if m.HasMode {
+		flags |= metaMode
+	}
+	if !m.ModTime.IsZero() {
+		flags |= metaModTime
+	}
+	if m.HasOwner {
+		flags |= metaOwner
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 0, 0, 0})
+	buf.WriteByte(flags)
+	binary.Write(&buf, binary.BigEndian, uint16(len(m.Name)))
+	buf.WriteString(m.Name)
+	var mtime int64
+	if !m.ModTime.IsZero() {
+		mtime = m.ModTime.UnixNano()
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(m.Mode&metaModeMask))
+	binary.Write(&buf, binary.BigEndian, mtime)
+	binary.Write(&buf, binary.BigEndian, uint32(m.UID))
+	binary.Write(&buf, binary.BigEndian, uint32(m.GID))
+
+	// Attributes are sorted, so the same metadata is always stored the same way
+	names := make([]string, 0, len(m.Xattrs))
+	for name := range m.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	binary.Write(&buf, binary.BigEndian, uint16(len(names)))
+	for _, name := range names {
+		binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+		buf.WriteString(name)
+		binary.Write(&buf, binary.BigEndian, uint32(len(m.Xattrs[name])))
+		buf.Write(m.Xattrs[name])
+	}
+
+	b := buf.Bytes()
+	b = append(b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[len(b)-4:], crc32.ChecksumIEEE(b[4:len(b)-4]))
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	return b
+}
+
+// readMetadata reads metadata written by encode and returns it with its size.
+func readMetadata(r io.Reader) (*Metadata, int, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, 0, err
+	}
+	if size < 4 || size > maxMetaSize {
+		return nil, 0, fmt.Errorf("bad size of metadata %d", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, 0, err
+	}
+	body := b[:len(b)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(b[len(body):]) {
+		return nil, 0, errors.New("metadata is damaged")
+	}
+
+	m, err := parseMetadata(bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("bad metadata: %v", err)
+	}
+	return m, 4 + int(size), nil
+}
+
+// parseMetadata parses body of metadata.
+func parseMetadata(r *bytes.Reader) (*Metadata, error) {
+	var n uint16
+	readString := func() (string, error) {
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return "", err
+		}
+		if int(n) > r.Len() {
+			return "", io.ErrUnexpectedEOF
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return string(b), err
+	}
+
+	flags, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{}
+	if m.Name, err = readString(); err != nil {
+		return nil, err
+	}
+	if m.Name != "" {
+		if err = CheckName(m.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	var fixed struct {
+		Mode  uint32
+		MTime int64
+		UID   uint32
+		GID   uint32
+		Attrs uint16
+	}
+	if err = binary.Read(r, binary.BigEndian, &fixed); err != nil {
+		return nil, err
+	}
+	if flags&metaMode != 0 {
+		m.Mode, m.HasMode = os.FileMode(fixed.Mode)&metaModeMask, true
+	}
+	if flags&metaModTime != 0 {
+		m.ModTime = time.Unix(0, fixed.MTime)
+	}
+	if flags&metaOwner != 0 {
+		m.UID, m.GID, m.HasOwner = int(fixed.UID), int(fixed.GID), true
+	}
+
+	for i := 0; i < int(fixed.Attrs); i++ {
+		name, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		var size uint32
+		if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		value := make([]byte, size)
+		if _, err = io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		if m.Xattrs == nil {
+			m.Xattrs = make(map[string][]byte)
+		}
+		m.Xattrs[name] = value
+	}
+
+	if r.Len() != 0 {
+		return nil, errors.New("unexpected data after metadata")
+	}
+	return m, nil
+}
@@ -0,0 +1,15 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package huffman
+
+import "os"
+
+// fileOwner returns owner of file. Owners are not supported on this system.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// setOwner does nothing, as owners are not supported on this system.
+func setOwner(name string, uid, gid int) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package huffman
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns owner of file.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// setOwner changes owner of named file. Nothing is changed if the process
+// is not permitted to do it, as only superuser can give files away.
+func setOwner(name string, uid, gid int) error {
+	if err := os.Lchown(name, uid, gid); err != nil && !os.IsPermission(err) {
+		return err
+	}
+	return nil
+}
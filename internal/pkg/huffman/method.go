@@ -0,0 +1,48 @@
+package huffman
+
+import "fmt"
+
+// Method selects how symbols are coded and laid out in the output.
+type Method byte
+
+const (
+	// MethodHuffman writes all codes to a single bit stream.
+	MethodHuffman Method = iota
+	// MethodInterleaved splits data into four Huffman-coded streams
+	// sharing one table, so they can be decoded in an interleaved fashion.
+	MethodInterleaved
+	// MethodArithmetic uses arithmetic coding instead of Huffman codes.
+	MethodArithmetic
+	// MethodRANS uses range asymmetric numeral systems coding.
+	MethodRANS
+)
+
+var methodNames = map[Method]string{
+	MethodHuffman:     "huffman",
+	MethodInterleaved: "interleaved",
+	MethodArithmetic:  "arith",
+	MethodRANS:        "rans",
+}
+
+// Methods returns all supported methods.
+func Methods() []Method {
+	return []Method{MethodHuffman, MethodInterleaved, MethodArithmetic, MethodRANS}
+}
+
+// String returns method name.
+func (m Method) String() string {
+	if name, ok := methodNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("method(%d)", byte(m))
+}
+
+// ParseMethod returns method by its name.
+func ParseMethod(name string) (Method, error) {
+	for m, n := range methodNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown method %q", name)
+}
@@ -0,0 +1,296 @@
+package huffman
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/cravtos/huffman/internal/pkg/crypt"
+	"github.com/cravtos/huffman/internal/pkg/filter"
+	"github.com/cravtos/huffman/internal/pkg/tree"
+)
+
+// DefaultBlockSize is the default amount of data coded in one block.
+const DefaultBlockSize = 1 << 20
+
+// MaxBlockSize is the maximum amount of data coded in one block.
+const MaxBlockSize = 1 << 30
+
+// MaxParity is the maximum redundancy of parity in percents.
+const MaxParity = 50
+
+// DefaultMaxCodeLen is the default maximum length of Huffman code in bits.
+const DefaultMaxCodeLen = 32
+
+// Options configures encoding. Zero value of every field means its default,
+// and everything needed for decoding is stored in the stream.
+type Options struct {
+	Method  Method          // Coding method and layout of encoded data
+	Filters []filter.Filter // Filters applied to data before coding
+	Words   bool            // Code words and separators instead of bytes
+	Runs    RunMode         // Whether runs of repeated symbols are collapsed
+
+	// Samples of fixed width
+	Width     uint8     // Width of sample in bits: 8, 16 or 32. Zero means plain bytes
+	BigEndian bool      // Byte order of samples
+	Predictor Predictor // Code prediction errors instead of samples
+	Escape    int       // Maximum number of distinct symbols, zero means DefaultEscape
+
+	BlockSize   int          // Amount of data coded in one block, zero means DefaultBlockSize
+	MaxCodeLen  int          // Maximum length of Huffman code, zero means DefaultMaxCodeLen
+	Header      HeaderFormat // How Huffman codes are stored
+	Checksum    Checksum     // Checksum of decoded data of every block
+	Concurrency int          // Number of blocks encoded in parallel, zero means number of CPUs
+	Sync        bool         // Precede every block with sync marker, so damaged streams can be recovered
+	Parity      int          // Redundancy of Reed-Solomon parity in percents, zero means no parity
+	Secret      crypt.Secret // Passphrase or key to encrypt stream with, zero value means no encryption
+	Metadata    *Metadata    // Name, mode and times of encoded file, nil means none is stored
+
+	// Progress is called after every encoded block with amount of data encoded
+	// and total amount of data, which is -1 if unknown
+	Progress func(done, total int64)
+}
+
+// DecodeOptions configures decoding.
+type DecodeOptions struct {
+	// MaxOutput limits amount of decoded data, zero means no limit.
+	// Decoding of larger streams fails with ErrTooLarge before the block exceeding limit is decoded
+	MaxOutput int64
+
+	// Secret is passphrase or key to decrypt encrypted stream with
+	Secret crypt.Secret
+
+	// PublicKey, if set, makes decoding of streams not signed by this Ed25519 key fail.
+	// Signature is checked at the end of stream, after all data is decoded
+	PublicKey ed25519.PublicKey
+	// Signature is a detached signature used instead of signature trailer of stream
+	Signature []byte
+
+	// Progress is called after every decoded chunk with amount of stream consumed
+	// and total size of stream, which is -1 if unknown
+	Progress func(done, total int64)
+
+	// Corrected is called at the end of decoding of stream with parity
+	// with number of symbols corrected
+	Corrected func(n int)
+}
+
+// Option changes a field of Options.
+type Option func(*Options)
+
+// NewOptions returns validated Options with given options applied
+// and defaults filled in.
+func NewOptions(options ...Option) (Options, error) {
+	var opts Options
+	for _, o := range options {
+		o(&opts)
+	}
+
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.MaxCodeLen == 0 {
+		opts.MaxCodeLen = DefaultMaxCodeLen
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if opts.Width != 0 && opts.Escape == 0 {
+		opts.Escape = DefaultEscape
+	}
+
+	return opts, opts.Validate()
+}
+
+// WithMethod sets coding method.
+func WithMethod(m Method) Option {
+	return func(opts *Options) { opts.Method = m }
+}
+
+// WithFilters sets filters applied to data before coding.
+func WithFilters(filters ...filter.Filter) Option {
+	return func(opts *Options) { opts.Filters = filters }
+}
+
+// WithWords enables coding of words and separators.
+func WithWords() Option {
+	return func(opts *Options) { opts.Words = true }
+}
+
+// WithRuns sets whether runs of repeated symbols are collapsed.
+func WithRuns(m RunMode) Option {
+	return func(opts *Options) { opts.Runs = m }
+}
+
+// WithSamples enables coding of samples of width bits predicted by p.
+func WithSamples(width uint8, bigEndian bool, p Predictor) Option {
+	return func(opts *Options) {
+		opts.Width = width
+		opts.BigEndian = bigEndian
+		opts.Predictor = p
+	}
+}
+
+// WithEscape sets maximum number of distinct sample symbols.
+func WithEscape(n int) Option {
+	return func(opts *Options) { opts.Escape = n }
+}
+
+// WithBlockSize sets amount of data coded in one block.
+func WithBlockSize(n int) Option {
+	return func(opts *Options) { opts.BlockSize = n }
+}
+
+// WithMaxCodeLen sets maximum length of Huffman code.
+func WithMaxCodeLen(n int) Option {
+	return func(opts *Options) { opts.MaxCodeLen = n }
+}
+
+// WithHeader sets how Huffman codes are stored.
+func WithHeader(f HeaderFormat) Option {
+	return func(opts *Options) { opts.Header = f }
+}
+
+// WithChecksum sets checksum of blocks.
+func WithChecksum(c Checksum) Option {
+	return func(opts *Options) { opts.Checksum = c }
+}
+
+// WithConcurrency sets number of blocks encoded in parallel.
+func WithConcurrency(n int) Option {
+	return func(opts *Options) { opts.Concurrency = n }
+}
+
+// WithSync enables sync markers in front of every block.
+func WithSync() Option {
+	return func(opts *Options) { opts.Sync = true }
+}
+
+// WithParity enables Reed-Solomon parity of given redundancy in percents.
+func WithParity(percent int) Option {
+	return func(opts *Options) { opts.Parity = percent }
+}
+
+// WithPassphrase enables encryption with key derived from passphrase.
+func WithPassphrase(passphrase []byte) Option {
+	return func(opts *Options) { opts.Secret = crypt.Secret{Passphrase: passphrase} }
+}
+
+// WithKey enables encryption with raw key of crypt.KeySize bytes.
+func WithKey(key []byte) Option {
+	return func(opts *Options) { opts.Secret = crypt.Secret{Key: key} }
+}
+
+// WithMetadata sets metadata of encoded file stored in stream.
+func WithMetadata(m *Metadata) Option {
+	return func(opts *Options) { opts.Metadata = m }
+}
+
+// WithProgress sets function called after every encoded block.
+func WithProgress(fn func(done, total int64)) Option {
+	return func(opts *Options) { opts.Progress = fn }
+}
+
+// Validate checks whether options are consistent.
+func (opts Options) Validate() error {
+	if _, ok := methodNames[opts.Method]; !ok {
+		return fmt.Errorf("unknown method %d", opts.Method)
+	}
+
+	if len(opts.Filters) > maxFilters {
+		return fmt.Errorf("too many filters: %d", len(opts.Filters))
+	}
+	for _, f := range opts.Filters {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if opts.BlockSize < 0 || opts.BlockSize > MaxBlockSize {
+		return fmt.Errorf("block size must be between 1 and %d, got %d", MaxBlockSize, opts.BlockSize)
+	}
+	if opts.MaxCodeLen < 0 || opts.MaxCodeLen > tree.MaxCodeLen {
+		return fmt.Errorf("maximum code length must be between 1 and %d, got %d", tree.MaxCodeLen, opts.MaxCodeLen)
+	}
+	if _, ok := headerFormatNames[opts.Header]; !ok {
+		return fmt.Errorf("unknown header format %d", opts.Header)
+	}
+	if _, ok := checksumNames[opts.Checksum]; !ok {
+		return fmt.Errorf("unknown checksum %d", opts.Checksum)
+	}
+	if opts.Sync && opts.Checksum == ChecksumNone {
+		return errors.New("sync markers require checksum of blocks")
+	}
+	if opts.Parity < 0 || opts.Parity > MaxParity {
+		return fmt.Errorf("parity must be between 1 and %d percents, got %d", MaxParity, opts.Parity)
+	}
+	if err := opts.Secret.Validate(); err != nil {
+		return err
+	}
+	if opts.Metadata != nil {
+		if err := opts.Metadata.validate(); err != nil {
+			return err
+		}
+	}
+	if opts.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative, got %d", opts.Concurrency)
+	}
+
+	if _, ok := runModeNames[opts.Runs]; !ok {
+		return fmt.Errorf("unknown run mode %d", opts.Runs)
+	}
+	if opts.Runs == RunsOn && opts.Width == 32 {
+		return errors.New("runs can not be collapsed for 32 bit samples")
+	}
+
+	if opts.Width != 0 {
+		if opts.Words {
+			return errors.New("words and samples can not be used together")
+		}
+		if !validWidth(opts.Width) {
+			return fmt.Errorf("bad sample width %d", opts.Width)
+		}
+		if _, ok := predictorNames[opts.Predictor]; !ok {
+			return fmt.Errorf("unknown predictor %d", opts.Predictor)
+		}
+		if opts.Escape != 0 && opts.Escape < 2 {
+			return fmt.Errorf("escape limit must be at least 2, got %d", opts.Escape)
+		}
+	}
+
+	return nil
+}
+
+// blockSize returns amount of data coded in one block.
+func (opts Options) blockSize() int {
+	if opts.BlockSize == 0 {
+		return DefaultBlockSize
+	}
+	return opts.BlockSize
+}
+
+// maxCodeLen returns maximum length of Huffman code.
+func (opts Options) maxCodeLen() int {
+	if opts.MaxCodeLen == 0 {
+		return DefaultMaxCodeLen
+	}
+	return opts.MaxCodeLen
+}
+
+// streamHeader returns parameters stored in stream header.
+func (opts Options) streamHeader() streamHeader {
+	h := streamHeader{checksum: opts.Checksum, sync: opts.Sync}
+	if opts.Metadata != nil {
+		h.meta, h.metaSize = true, len(opts.Metadata.encode())
+	}
+	return h
+}
+
+// concurrency returns number of blocks encoded in parallel.
+func (opts Options) concurrency() int {
+	if opts.Concurrency == 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return opts.Concurrency
+}
@@ -0,0 +1,261 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/cravtos/huffman/internal/pkg/crypt"
+	"github.com/cravtos/huffman/internal/pkg/parity"
+	"github.com/cravtos/huffman/internal/pkg/sign"
+)
+
+// Reader decodes stream written by Writer. Blocks are decoded one by one,
+// so the underlying reader is read sequentially.
+//
+// Reader implements io.ReadCloser.
+type Reader struct {
+	base *bufio.Reader // Reads the whole stream
+	r    *bufio.Reader // Reads current member, decrypted and corrected
+	cr   *countReader  // Counts data read by base
+	data []byte        // Decoded data of current block not read yet
+
+	header    streamHeader   // Parameters of current member
+	meta      *Metadata      // Metadata of the first member, nil if there is none
+	parity    *parity.Reader // Corrects errors of member with parity, nil if there is no parity
+	sig       *sign.Reader   // Strips signature trailer and hashes stream
+	publicKey []byte         // Key which must have signed stream, nil if signature is not checked
+	signature []byte         // Detached signature, nil if trailer is used
+	secret    crypt.Secret   // Passphrase or key of encrypted members
+	maxOutput int64          // Maximum amount of decoded data, zero means no limit
+
+	progress  func(done, total int64) // Reports progress of DecodeTo
+	corrected func(n int)             // Reports corrected symbols at the end of DecodeTo
+	total     int64                   // Size of stream, -1 if unknown
+
+	dataSize   uint64 // Amount of decoded data
+	memberSize uint64 // Amount of decoded data of current member
+	nBlocks    uint32 // Number of decoded blocks of current member
+	nMembers   int    // Number of members read
+
+	err error // First error occurred, io.EOF at the end of stream
+}
+
+// ErrTooLarge is returned when decoded data exceeds DecodeOptions.MaxOutput.
+var ErrTooLarge = errors.New("huffman: decoded data exceeds output limit")
+
+// NewReader returns Reader which decodes stream read from r.
+// Stream header is read immediately.
+func NewReader(r io.Reader) (*Reader, error) {
+	return NewReaderWith(r, DecodeOptions{})
+}
+
+// NewReaderWith returns Reader which decodes stream read from r using given options.
+// Progress and corrected symbols are reported only by DecodeTo.
+//
+// Streams written one after another are decoded as one stream of their
+// concatenated data, so r may hold several members until EOF.
+func NewReaderWith(r io.Reader, opts DecodeOptions) (*Reader, error) {
+	sr := sign.NewReader(r)
+	cr := &countReader{r: sr}
+	hr := &Reader{
+		base:      bufio.NewReader(cr),
+		cr:        cr,
+		sig:       sr,
+		publicKey: opts.PublicKey,
+		signature: opts.Signature,
+		secret:    opts.Secret,
+		maxOutput: opts.MaxOutput,
+		progress:  opts.Progress,
+		corrected: opts.Corrected,
+		total:     inputSize(r),
+	}
+
+	if err := hr.openMember(); err != nil {
+		return nil, err
+	}
+	return hr, nil
+}
+
+// openMember reads header of next member of stream.
+func (hr *Reader) openMember() error {
+	hr.r, hr.parity = hr.base, nil
+	hr.memberSize, hr.nBlocks = 0, 0
+	hr.nMembers++
+
+	// Member with parity is read through correcting reader
+	if head, _ := hr.r.Peek(parity.HeaderSize); parity.Detect(head) {
+		pr, err := parity.NewReader(hr.r)
+		if err != nil {
+			return err
+		}
+		hr.parity, hr.r = pr, bufio.NewReader(pr)
+	}
+
+	// Encrypted member is read through decrypting reader
+	if head, _ := hr.r.Peek(len(crypt.Magic)); crypt.Detect(head) {
+		dr, err := crypt.NewReader(hr.r, hr.secret)
+		if err != nil {
+			return err
+		}
+		hr.r = bufio.NewReader(dr)
+	}
+
+	head := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(hr.r, head); err != nil {
+		return err
+	}
+	var err error
+	if hr.header, err = parseStreamHeader(head); err != nil || !hr.header.meta {
+		return err
+	}
+
+	// Metadata of the first member describes the whole stream
+	m, size, err := readMetadata(hr.r)
+	if err != nil {
+		return err
+	}
+	hr.header.metaSize = size
+	if hr.nMembers == 1 {
+		hr.meta = m
+	}
+	return nil
+}
+
+// Metadata returns metadata of encoded file, or nil if stream has none.
+func (hr *Reader) Metadata() *Metadata {
+	return hr.meta
+}
+
+// Read reads decoded data, decoding next block when needed.
+func (hr *Reader) Read(p []byte) (n int, err error) {
+	for len(hr.data) == 0 && hr.err == nil {
+		hr.err = hr.nextBlock()
+	}
+
+	n = copy(p, hr.data)
+	hr.data = hr.data[n:]
+	if len(hr.data) == 0 && n > 0 {
+		return n, nil
+	}
+	return n, hr.err
+}
+
+// nextBlock decodes next block. At the end of blocks it checks index and
+// footer, and returns io.EOF.
+func (hr *Reader) nextBlock() error {
+	maxData := uint64(math.MaxUint64)
+	if hr.maxOutput > 0 {
+		maxData = uint64(hr.maxOutput) - hr.dataSize
+	}
+
+	data, end, err := hr.header.readBlock(hr.r, hr.memberSize, maxData)
+	if err == ErrTooLarge || errors.Is(err, crypt.ErrAuth) {
+		return err
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return hr.errorf("block %d: %v", hr.nBlocks, err)
+	}
+
+	if !end {
+		hr.data = data
+		hr.dataSize += uint64(len(data))
+		hr.memberSize += uint64(len(data))
+		hr.nBlocks++
+		return nil
+	}
+
+	// Skip index and check footer
+	if _, err = io.CopyN(ioutil.Discard, hr.r, int64(hr.nBlocks)*indexEntrySize); err != nil {
+		return err
+	}
+
+	var footer [footerSize]byte
+	if _, err = io.ReadFull(hr.r, footer[:]); err != nil {
+		return err
+	}
+	if string(footer[12:]) != indexMagic ||
+		binary.BigEndian.Uint64(footer[:]) != hr.memberSize ||
+		binary.BigEndian.Uint32(footer[8:]) != hr.nBlocks {
+		return hr.errorf("footer does not match decoded data")
+	}
+
+	// Decrypted or corrected data ends with its member
+	if hr.r != hr.base {
+		if _, err = hr.r.Peek(1); err != io.EOF {
+			return hr.errorf("unexpected data after end of stream")
+		}
+	}
+
+	// Skip signature of member appended to signed file
+	if b, _ := hr.base.Peek(sign.TrailerSize); sign.IsTrailer(b) {
+		hr.base.Discard(sign.TrailerSize)
+	}
+	if _, err = hr.base.Peek(1); err != io.EOF {
+		if err = hr.openMember(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return hr.errorf("%v", err)
+		}
+		return nil
+	}
+
+	if hr.publicKey != nil {
+		if err = hr.sig.Verify(hr.publicKey, hr.signature); err != nil {
+			return err
+		}
+	}
+	return io.EOF
+}
+
+// errorf returns error of current member. Errors of the first member
+// are not prefixed, as most streams have only one member.
+func (hr *Reader) errorf(format string, args ...interface{}) error {
+	if hr.nMembers > 1 {
+		format = "member %d: " + format
+		args = append([]interface{}{hr.nMembers}, args...)
+	}
+	return fmt.Errorf(format, args...)
+}
+
+// Corrected returns number of symbols corrected by parity so far.
+func (hr *Reader) Corrected() int {
+	if hr.parity == nil {
+		return 0
+	}
+	return hr.parity.Corrected()
+}
+
+// consumed returns amount of stream consumed by decoder.
+func (hr *Reader) consumed() int64 {
+	return hr.cr.n - int64(hr.base.Buffered())
+}
+
+// countReader counts bytes read from r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// Close releases decoded data. It does not close the underlying reader.
+func (hr *Reader) Close() error {
+	hr.data = nil
+	if hr.err == nil || hr.err == io.EOF {
+		hr.err = errClosed
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/cravtos/huffman/internal/pkg/parity"
+	"github.com/cravtos/huffman/internal/pkg/sign"
+)
+
+// ReaderAt gives random access to data of encoded stream using its index.
+// Only blocks holding requested bytes are decoded.
+type ReaderAt struct {
+	r     io.ReaderAt
+	size  int64        // Size of decoded data
+	index []indexEntry // Positions of blocks
+	end   int64        // Stream offset of end of blocks
+
+	header streamHeader     // Parameters of stream
+	parity *parity.ReaderAt // Corrects errors of stream with parity, nil if there is no parity
+
+	mu     sync.Mutex
+	cached int    // Number of cached block, -1 if none
+	data   []byte // Decoded data of cached block
+
+	offset int64 // Offset used by Read and Seek
+}
+
+// NewReaderAt reads index of encoded stream of given size.
+// Returned reader implements io.ReaderAt, io.ReadSeeker and
+// decodes blocks only when they are read. Signature of stream is not checked.
+func NewReaderAt(r io.ReaderAt, size int64) (*ReaderAt, error) {
+	size, _, err := sign.Split(r, size)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := openParity(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if pr != nil {
+		r, size = pr, pr.Size()
+	}
+
+	if size < int64(streamHeaderSize+1+footerSize) {
+		return nil, errors.New("stream is too short")
+	}
+
+	header, err := readStreamHeader(r, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var footer [footerSize]byte
+	if _, err := r.ReadAt(footer[:], size-footerSize); err != nil {
+		return nil, err
+	}
+	if string(footer[12:]) != indexMagic {
+		return nil, errors.New("stream has no index")
+	}
+
+	ra := &ReaderAt{
+		r:      r,
+		size:   int64(binary.BigEndian.Uint64(footer[:])),
+		header: header,
+		parity: pr,
+		cached: -1,
+	}
+
+	n := int64(binary.BigEndian.Uint32(footer[8:]))
+	endSize := int64(header.frameSize(true))
+	ra.end = size - footerSize - n*indexEntrySize - endSize
+	if ra.end < header.size() {
+		return nil, errors.New("index is too large")
+	}
+
+	buf := make([]byte, endSize+n*indexEntrySize)
+	if _, err := r.ReadAt(buf, ra.end); err != nil {
+		return nil, err
+	}
+	fh, err := header.readFrame(bytes.NewReader(buf[:endSize]))
+	if err != nil || !fh.end || header.sync && fh.offset != uint64(ra.size) {
+		return nil, errors.New("index does not follow blocks")
+	}
+	buf = buf[endSize:]
+
+	// Read and check index entries
+	prev := indexEntry{0, uint64(header.size())}
+	for i := int64(0); i < n; i++ {
+		e := indexEntry{
+			dataOffset:   binary.BigEndian.Uint64(buf[i*indexEntrySize:]),
+			streamOffset: binary.BigEndian.Uint64(buf[i*indexEntrySize+8:]),
+		}
+		if i == 0 && e != prev || i > 0 && (e.dataOffset <= prev.dataOffset || e.streamOffset <= prev.streamOffset) {
+			return nil, fmt.Errorf("index entry %d is out of order", i)
+		}
+		if e.dataOffset >= uint64(ra.size) || e.streamOffset >= uint64(ra.end) {
+			return nil, fmt.Errorf("index entry %d is out of range", i)
+		}
+		ra.index = append(ra.index, e)
+		prev = e
+	}
+
+	if n == 0 && ra.size != 0 {
+		return nil, errors.New("index is empty")
+	}
+
+	// Index of the last member of concatenated stream points to blocks
+	// of the first one, so the last block must end where blocks end
+	if n > 0 {
+		last := int64(ra.index[n-1].streamOffset)
+		fh, err := header.readFrame(io.NewSectionReader(r, last, ra.end-last))
+		if err != nil || fh.end || last+int64(header.frameSize(false))+int64(fh.blockSize)+int64(header.checksum.size()) != ra.end {
+			return nil, errors.New("index does not match blocks, stream may have several members")
+		}
+	}
+
+	return ra, nil
+}
+
+// openParity returns correcting reader of stream with parity,
+// or nil if stream has no parity.
+func openParity(r io.ReaderAt, size int64) (*parity.ReaderAt, error) {
+	if size < parity.HeaderSize {
+		return nil, nil
+	}
+	head := make([]byte, parity.HeaderSize)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	if !parity.Detect(head) {
+		return nil, nil
+	}
+	return parity.NewReaderAt(r, size)
+}
+
+// Corrected returns number of symbols corrected by parity so far.
+func (ra *ReaderAt) Corrected() int {
+	if ra.parity == nil {
+		return 0
+	}
+	return ra.parity.Corrected()
+}
+
+// Size returns size of decoded data.
+func (ra *ReaderAt) Size() int64 {
+	return ra.size
+}
+
+// ReadAt reads len(p) bytes of decoded data starting at offset off.
+// It is safe to call ReadAt concurrently.
+func (ra *ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	for n < len(p) && off < ra.size {
+		// Find last block starting at or before off
+		i := sort.Search(len(ra.index), func(i int) bool {
+			return ra.index[i].dataOffset > uint64(off)
+		}) - 1
+
+		data, err := ra.block(i)
+		if err != nil {
+			return n, err
+		}
+
+		k := copy(p[n:], data[off-int64(ra.index[i].dataOffset):])
+		n += k
+		off += int64(k)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns decoded data of i-th block.
+func (ra *ReaderAt) block(i int) ([]byte, error) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	if ra.cached == i {
+		return ra.data, nil
+	}
+
+	start, end := int64(ra.index[i].streamOffset), ra.end
+	dataEnd := uint64(ra.size)
+	if i+1 < len(ra.index) {
+		end = int64(ra.index[i+1].streamOffset)
+		dataEnd = ra.index[i+1].dataOffset
+	}
+
+	section := io.NewSectionReader(ra.r, start, end-start)
+	data, last, err := ra.header.readBlock(section, ra.index[i].dataOffset, dataEnd-ra.index[i].dataOffset)
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %v", i, err)
+	}
+	if last || uint64(len(data)) != dataEnd-ra.index[i].dataOffset {
+		return nil, fmt.Errorf("block %d does not match index", i)
+	}
+
+	ra.cached, ra.data = i, data
+	return data, nil
+}
+
+// Read reads decoded data from current offset.
+func (ra *ReaderAt) Read(p []byte) (n int, err error) {
+	n, err = ra.ReadAt(p, ra.offset)
+	ra.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets offset for next Read.
+func (ra *ReaderAt) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += ra.offset
+	case io.SeekEnd:
+		offset += ra.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	ra.offset = offset
+	return offset, nil
+}
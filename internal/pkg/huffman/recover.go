@@ -0,0 +1,207 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cravtos/huffman/internal/pkg/sign"
+)
+
+// Range is a range of bytes of decoded data.
+type Range struct {
+	Offset int64
+	Size   int64
+}
+
+// RecoverReport describes result of recovery of damaged stream.
+type RecoverReport struct {
+	Size      int64   // Amount of data written, including zeros in place of damaged ranges
+	Damaged   []Range // Ranges of data which could not be recovered
+	Truncated bool    // End of blocks was not found, so data after Size may be lost
+	Corrected int     // Number of symbols corrected by parity
+}
+
+// Lost reports whether any data could not be recovered.
+func (rep *RecoverReport) Lost() bool {
+	return len(rep.Damaged) > 0 || rep.Truncated
+}
+
+// damage zero fills data up to offset and records it as damaged.
+func (rep *RecoverReport) damage(out io.Writer, offset int64) error {
+	if offset <= rep.Size {
+		return nil
+	}
+
+	rep.Damaged = append(rep.Damaged, Range{rep.Size, offset - rep.Size})
+	n, err := io.CopyN(out, zeroReader{}, offset-rep.Size)
+	rep.Size += n
+	return err
+}
+
+// Recover decodes every intact block of stream of given size to out.
+// Damaged blocks are written as zeros, so intact data keeps its offsets,
+// and their ranges are reported.
+//
+// Streams encoded with Options.Sync are scanned for sync markers,
+// so blocks following damaged ones are found even if their positions are lost.
+// Other streams are recovered only until the first damaged block header.
+// Errors of stream with parity are corrected first, and stripes
+// which can not be corrected are recovered as they are.
+// Members of concatenated stream are recovered one after another.
+func Recover(r io.ReaderAt, size int64, out io.Writer) (*RecoverReport, error) {
+	size, _, err := sign.Split(r, size)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := openParity(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if pr != nil {
+		pr.Raw = true
+		r, size = pr, pr.Size()
+	}
+
+	rep := &RecoverReport{}
+	err = recoverMembers(r, size, out, rep)
+	if pr != nil {
+		rep.Corrected = pr.Corrected()
+	}
+	return rep, err
+}
+
+// recoverMembers recovers every member of concatenated stream.
+// Member following the end of blocks of previous one is found by its magic.
+func recoverMembers(r io.ReaderAt, size int64, out io.Writer, rep *RecoverReport) error {
+	h, err := readStreamHeader(r, 0)
+	if err != nil {
+		return err
+	}
+
+	start := int64(0)
+	for {
+		var end int64
+		if h.sync {
+			end, err = recoverSync(r, start, size, h, out, rep)
+		} else {
+			end, err = recoverPlain(r, start, size, h, out, rep)
+		}
+		if err != nil || end < 0 {
+			return err
+		}
+
+		// Skip index and look for header of next member
+		for start = end; ; start++ {
+			if start, err = find(r, magic, start, size); err != nil || start < 0 {
+				return err
+			}
+			if h, err = readStreamHeader(r, start); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// recoverSync decodes every block of member starting at start following intact sync marker.
+// Returns position of the end of blocks, or -1 if it was not found.
+func recoverSync(r io.ReaderAt, start, size int64, h streamHeader, out io.Writer, rep *RecoverReport) (int64, error) {
+	base := rep.Size // Offset of member data in recovered data
+	pos := start + h.size()
+	for {
+		at, err := find(r, syncMarker, pos, size)
+		if err != nil {
+			return -1, err
+		}
+		if at < 0 {
+			rep.Truncated = true
+			return -1, nil
+		}
+		pos = at + int64(len(syncMarker))
+
+		section := io.NewSectionReader(r, at, size-at)
+		fh, err := h.readFrame(section)
+		if err != nil || fh.offset > 1<<62 || base+int64(fh.offset) < rep.Size {
+			// Not a frame, or frame header is damaged
+			continue
+		}
+		if fh.end {
+			return at + int64(h.frameSize(true)), rep.damage(out, base+int64(fh.offset))
+		}
+
+		data, err := h.readPayload(section, fh)
+		if err != nil {
+			continue
+		}
+
+		if err = rep.damage(out, base+int64(fh.offset)); err != nil {
+			return -1, err
+		}
+		if _, err = out.Write(data); err != nil {
+			return -1, err
+		}
+		rep.Size += int64(len(data))
+		pos = at + int64(h.frameSize(false)) + int64(fh.blockSize) + int64(h.checksum.size())
+	}
+}
+
+// recoverPlain decodes blocks of member starting at start one by one,
+// skipping damaged ones while their headers are intact.
+// Returns position of the end of blocks, or -1 if it was not found.
+func recoverPlain(r io.ReaderAt, start, size int64, h streamHeader, out io.Writer, rep *RecoverReport) (int64, error) {
+	pos := start + h.size()
+	for {
+		section := io.NewSectionReader(r, pos, size-pos)
+		fh, err := h.readFrame(section)
+		if err != nil {
+			rep.Truncated = true
+			return -1, nil
+		}
+		if fh.end {
+			return pos + int64(h.frameSize(true)), nil
+		}
+
+		data, err := h.readPayload(section, fh)
+		if err != nil {
+			err = rep.damage(out, rep.Size+int64(fh.dataSize))
+		} else {
+			_, err = out.Write(data)
+			rep.Size += int64(len(data))
+		}
+		if err != nil {
+			return -1, err
+		}
+		pos += int64(h.frameSize(false)) + int64(fh.blockSize) + int64(h.checksum.size())
+	}
+}
+
+// find returns position of the first marker in r at or after pos,
+// or -1 if there is none.
+func find(r io.ReaderAt, marker string, pos, size int64) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for pos < size {
+		n, err := r.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			return -1, err
+		}
+		if i := bytes.Index(buf[:n], []byte(marker)); i >= 0 {
+			return pos + int64(i), nil
+		}
+		if err == io.EOF || n < len(marker) {
+			break
+		}
+
+		// Next chunk overlaps, so markers crossing chunk boundary are found
+		pos += int64(n - len(marker) + 1)
+	}
+	return -1, nil
+}
+
+// zeroReader reads zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
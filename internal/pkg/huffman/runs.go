@@ -0,0 +1,80 @@
+package huffman
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/cravtos/huffman/internal/pkg/rle"
+	"github.com/icza/bitio"
+)
+
+// RunMode selects whether runs of repeated symbols are collapsed before coding.
+type RunMode byte
+
+const (
+	// RunsAuto collapses runs when there are enough of them.
+	RunsAuto RunMode = iota
+	// RunsOff never collapses runs.
+	RunsOff
+	// RunsOn always collapses runs.
+	RunsOn
+)
+
+var runModeNames = map[RunMode]string{
+	RunsAuto: "auto",
+	RunsOff:  "off",
+	RunsOn:   "on",
+}
+
+// String returns run mode name.
+func (m RunMode) String() string {
+	if name, ok := runModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("runs(%d)", byte(m))
+}
+
+// ParseRunMode returns run mode by its name.
+func ParseRunMode(name string) (RunMode, error) {
+	for m, n := range runModeNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown run mode %q", name)
+}
+
+// useRuns reports whether runs of symbols of width bits should be collapsed.
+// Run symbols extend alphabet by at least one bit, so 32 bit symbols are never collapsed.
+func (m RunMode) useRuns(symbols []uint32, width uint8) bool {
+	switch m {
+	case RunsOn:
+		return width < 32
+	case RunsAuto:
+		return width < 32 && rle.Worth(symbols)
+	}
+	return false
+}
+
+// runsWidth returns number of bits needed to write symbols of width bits
+// together with run symbols following them, which start at 1<<width.
+func runsWidth(width uint8) uint8 {
+	return uint8(bits.Len32(1<<width + rle.Classes - 1))
+}
+
+// writeRuns writes extra bits of every run after coded symbols.
+func writeRuns(w *bitio.Writer, runs []rle.Run) error {
+	for _, r := range runs {
+		w.TryWriteBitsUnsafe(uint64(r.Extra), r.Class)
+	}
+	return w.TryError
+}
+
+// readRuns expands run symbols reading their extra bits from r.
+// Symbols below base are left as they are, and no more than limit symbols are produced.
+func readRuns(r *bitio.Reader, symbols []uint32, base uint32, limit int) ([]uint32, error) {
+	return rle.Decode(symbols, base, limit, func(class uint8) (uint32, error) {
+		u, err := r.ReadBits(class)
+		return uint32(u), err
+	})
+}
@@ -0,0 +1,206 @@
+package huffman
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Predictor guesses next sample from previous ones, so that only residual is coded.
+type Predictor byte
+
+const (
+	// PredictNone codes samples as they are.
+	PredictNone Predictor = iota
+	// PredictDelta codes difference with previous sample.
+	PredictDelta
+	// PredictLinear codes difference with linear extrapolation of two previous samples.
+	PredictLinear
+)
+
+var predictorNames = map[Predictor]string{
+	PredictNone:   "none",
+	PredictDelta:  "delta",
+	PredictLinear: "linear",
+}
+
+// String returns predictor name.
+func (p Predictor) String() string {
+	if name, ok := predictorNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("predictor(%d)", byte(p))
+}
+
+// ParsePredictor returns predictor by its name.
+func ParsePredictor(name string) (Predictor, error) {
+	for p, n := range predictorNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown predictor %q", name)
+}
+
+// DefaultEscape is the default maximum number of distinct sample symbols.
+const DefaultEscape = 1024
+
+// readSamples splits data into samples of width bits.
+// Returns samples and remaining bytes which do not form a whole sample.
+func readSamples(data []byte, width uint8, bigEndian bool) (samples []uint32, tail []byte) {
+	size := int(width / 8)
+	n := len(data) / size
+
+	samples = make([]uint32, n)
+	for i := range samples {
+		var v uint32
+		for j := 0; j < size; j++ {
+			b := data[i*size+j]
+			if bigEndian {
+				v = v<<8 | uint32(b)
+			} else {
+				v |= uint32(b) << (8 * j)
+			}
+		}
+		samples[i] = v
+	}
+
+	return samples, data[n*size:]
+}
+
+// writeSamples is the inverse of readSamples.
+func writeSamples(samples []uint32, tail []byte, width uint8, bigEndian bool) []byte {
+	size := int(width / 8)
+
+	data := make([]byte, 0, len(samples)*size+len(tail))
+	for _, v := range samples {
+		for j := 0; j < size; j++ {
+			if bigEndian {
+				data = append(data, byte(v>>(8*(size-1-j))))
+			} else {
+				data = append(data, byte(v>>(8*j)))
+			}
+		}
+	}
+
+	return append(data, tail...)
+}
+
+// mask returns bit mask of width bits.
+func mask(width uint8) uint32 {
+	return uint32(uint64(1)<<width - 1)
+}
+
+// predict returns prediction of sample following prev1 and prev2 (the one before prev1).
+func (p Predictor) predict(prev1, prev2 uint32) uint32 {
+	switch p {
+	case PredictDelta:
+		return prev1
+	case PredictLinear:
+		return 2*prev1 - prev2
+	}
+	return 0
+}
+
+// residuals replaces samples with zigzag encoded prediction errors.
+func (p Predictor) residuals(samples []uint32, width uint8) []uint32 {
+	if p == PredictNone {
+		return samples
+	}
+
+	res := make([]uint32, len(samples))
+	var prev1, prev2 uint32
+	for i, v := range samples {
+		res[i] = zigzag(v-p.predict(prev1, prev2), width)
+		prev1, prev2 = v, prev1
+	}
+	return res
+}
+
+// samples is the inverse of residuals.
+func (p Predictor) samples(res []uint32, width uint8) []uint32 {
+	if p == PredictNone {
+		return res
+	}
+
+	samples := make([]uint32, len(res))
+	var prev1, prev2 uint32
+	for i, r := range res {
+		v := (unzigzag(r, width) + p.predict(prev1, prev2)) & mask(width)
+		samples[i] = v
+		prev1, prev2 = v, prev1
+	}
+	return samples
+}
+
+// zigzag maps signed width bits value to unsigned one, so that
+// values close to zero get small numbers: 0, -1, 1, -2, 2...
+func zigzag(v uint32, width uint8) uint32 {
+	v &= mask(width)
+	sign := -(v >> (width - 1)) // All ones if negative
+	return (v<<1 ^ sign) & mask(width)
+}
+
+// unzigzag is the inverse of zigzag.
+func unzigzag(z uint32, width uint8) uint32 {
+	return (z>>1 ^ -(z & 1)) & mask(width)
+}
+
+// escapeRare keeps no more than max-1 most frequent symbols and replaces
+// the rest with escape symbol. Escape symbol is the smallest value which is not kept.
+// Returns escape symbol and replaced values in order of appearance.
+func escapeRare(symbols []uint32, max int) (esc uint32, escaped []uint32) {
+	freq := make(map[uint32]uint)
+	for _, s := range symbols {
+		freq[s]++
+	}
+	if len(freq) <= max {
+		return 0, nil
+	}
+
+	// Sort symbols by frequency, then by value
+	order := make([]uint32, 0, len(freq))
+	for s := range freq {
+		order = append(order, s)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if freq[order[i]] != freq[order[j]] {
+			return freq[order[i]] > freq[order[j]]
+		}
+		return order[i] < order[j]
+	})
+
+	kept := make(map[uint32]bool, max-1)
+	for _, s := range order[:max-1] {
+		kept[s] = true
+	}
+	for kept[esc] {
+		esc++
+	}
+
+	for i, s := range symbols {
+		if !kept[s] {
+			escaped = append(escaped, s)
+			symbols[i] = esc
+		}
+	}
+
+	return esc, escaped
+}
+
+// unescape replaces escape symbols with escaped values.
+func unescape(symbols []uint32, esc uint32, escaped []uint32) error {
+	for i, s := range symbols {
+		if s != esc {
+			continue
+		}
+		if len(escaped) == 0 {
+			return fmt.Errorf("escape symbol at %d has no value", i)
+		}
+		symbols[i], escaped = escaped[0], escaped[1:]
+	}
+
+	if len(escaped) != 0 {
+		return fmt.Errorf("%d escaped values left unused", len(escaped))
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/cravtos/huffman/internal/pkg/crypt"
+	"github.com/cravtos/huffman/internal/pkg/parity"
+)
+
+// Writer encodes data written to it. Data is coded in blocks,
+// so nothing but the stream header is written until a block is filled or Writer is closed.
+// Up to Options.Concurrency blocks are encoded in parallel.
+//
+// Writer implements io.WriteCloser.
+type Writer struct {
+	w      *bufio.Writer
+	opts   Options
+	header streamHeader   // Parameters of stream
+	parity *parity.Writer // Adds parity to encoded data, nil if disabled
+	crypt  *crypt.Writer  // Encrypts encoded data, nil if disabled
+	buf    []byte         // Data of current block
+	index  []indexEntry   // Positions of written blocks
+
+	pending []chan encodedBlock // Blocks being encoded, in order of data
+	free    [][]byte            // Buffers of written blocks
+
+	dataOffset   uint64 // Amount of data written
+	streamOffset uint64 // Amount of encoded data written
+	total        int64  // Total amount of data passed to Options.Progress
+
+	err error // First error occurred
+}
+
+// encodedBlock is a result of encoding of one block.
+type encodedBlock struct {
+	data  []byte // Buffer of data, modified by filters
+	size  int    // Size of data
+	sum   []byte // Checksum of data
+	block []byte
+	err   error
+}
+
+// errClosed is returned on use of closed Writer or Reader.
+var errClosed = errors.New("huffman: use of closed stream")
+
+// NewWriter returns Writer which encodes data to w using given options.
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var pw *parity.Writer
+	if opts.Parity != 0 {
+		var err error
+		if pw, err = parity.NewWriter(w, opts.Parity); err != nil {
+			return nil, err
+		}
+		w = pw
+	}
+
+	var cw *crypt.Writer
+	if !opts.Secret.IsZero() {
+		var err error
+		if cw, err = crypt.NewWriter(w, opts.Secret); err != nil {
+			return nil, err
+		}
+		w = cw
+	}
+
+	header := opts.streamHeader()
+	hw := &Writer{
+		w:            bufio.NewWriter(w),
+		parity:       pw,
+		crypt:        cw,
+		opts:         opts,
+		header:       header,
+		buf:          make([]byte, 0, opts.blockSize()),
+		streamOffset: uint64(header.size()),
+		total:        -1,
+	}
+	hw.w.WriteString(magic)
+	hw.err = hw.w.WriteByte(hw.header.encode())
+	if opts.Metadata != nil && hw.err == nil {
+		_, hw.err = hw.w.Write(opts.Metadata.encode())
+	}
+	return hw, hw.err
+}
+
+// Write buffers p and encodes every filled block.
+func (hw *Writer) Write(p []byte) (n int, err error) {
+	for len(p) > 0 && hw.err == nil {
+		k := copy(hw.buf[len(hw.buf):cap(hw.buf)], p)
+		hw.buf = hw.buf[:len(hw.buf)+k]
+		n += k
+		p = p[k:]
+
+		if len(hw.buf) == cap(hw.buf) {
+			hw.err = hw.startBlock()
+		}
+	}
+
+	return n, hw.err
+}
+
+// startBlock starts encoding of buffered data in background.
+// If too many blocks are being encoded, it waits for the first one and writes it.
+func (hw *Writer) startBlock() error {
+	if len(hw.buf) == 0 {
+		return nil
+	}
+
+	data, opts := hw.buf, hw.opts
+	ch := make(chan encodedBlock, 1)
+	go func() {
+		b := encodedBlock{data: data, size: len(data)}
+		b.sum = opts.Checksum.sum(nil, data)
+		b.block, b.err = encodeBlock(data, opts)
+		ch <- b
+	}()
+	hw.pending = append(hw.pending, ch)
+
+	// Reuse buffer of written block if there is one
+	if n := len(hw.free); n > 0 {
+		hw.buf, hw.free = hw.free[n-1], hw.free[:n-1]
+	} else {
+		hw.buf = make([]byte, 0, hw.opts.blockSize())
+	}
+
+	if len(hw.pending) >= hw.opts.concurrency() {
+		return hw.writeBlock()
+	}
+	return nil
+}
+
+// writeBlock waits for the first block being encoded and writes it.
+func (hw *Writer) writeBlock() error {
+	b := <-hw.pending[0]
+	hw.pending = hw.pending[1:]
+	if b.err != nil {
+		return b.err
+	}
+
+	hw.w.Write(hw.header.appendFrame(nil, frameHeader{
+		offset:    hw.dataOffset,
+		dataSize:  uint32(b.size),
+		blockSize: uint32(len(b.block)),
+	}))
+	hw.w.Write(b.block)
+	if _, err := hw.w.Write(b.sum); err != nil {
+		return err
+	}
+
+	hw.index = append(hw.index, indexEntry{hw.dataOffset, hw.streamOffset})
+	hw.dataOffset += uint64(b.size)
+	hw.streamOffset += uint64(hw.header.frameSize(false) + len(b.block) + len(b.sum))
+	hw.free = append(hw.free, b.data[:0])
+
+	if hw.opts.Progress != nil {
+		hw.opts.Progress(int64(hw.dataOffset), hw.total)
+	}
+	return nil
+}
+
+// writeBlocks encodes buffered data and writes all blocks being encoded.
+func (hw *Writer) writeBlocks() error {
+	if err := hw.startBlock(); err != nil {
+		return err
+	}
+	for len(hw.pending) > 0 {
+		if err := hw.writeBlock(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush encodes buffered data as a block, even if it is not filled,
+// and flushes it to the underlying writer. With Options.Parity or Options.Secret,
+// data is written to the underlying writer only by whole stripes or chunks.
+func (hw *Writer) Flush() error {
+	if hw.err != nil {
+		return hw.err
+	}
+	if hw.err = hw.writeBlocks(); hw.err != nil {
+		return hw.err
+	}
+	hw.err = hw.w.Flush()
+	return hw.err
+}
+
+// Close encodes buffered data and writes index of blocks.
+// It does not close the underlying writer.
+func (hw *Writer) Close() error {
+	if hw.err != nil {
+		return hw.err
+	}
+	if hw.err = hw.writeBlocks(); hw.err != nil {
+		return hw.err
+	}
+
+	// Write end of blocks, index and footer
+	hw.w.Write(hw.header.appendFrame(nil, frameHeader{end: true, offset: hw.dataOffset}))
+	var entry [indexEntrySize]byte
+	for _, e := range hw.index {
+		binary.BigEndian.PutUint64(entry[:], e.dataOffset)
+		binary.BigEndian.PutUint64(entry[8:], e.streamOffset)
+		hw.w.Write(entry[:])
+	}
+
+	var footer [footerSize]byte
+	binary.BigEndian.PutUint64(footer[:], hw.dataOffset)
+	binary.BigEndian.PutUint32(footer[8:], uint32(len(hw.index)))
+	copy(footer[12:], indexMagic)
+	hw.w.Write(footer[:])
+
+	if hw.err = hw.w.Flush(); hw.err != nil {
+		return hw.err
+	}
+	if hw.crypt != nil {
+		if hw.err = hw.crypt.Close(); hw.err != nil {
+			return hw.err
+		}
+	}
+	if hw.parity != nil {
+		if hw.err = hw.parity.Close(); hw.err != nil {
+			return hw.err
+		}
+	}
+	hw.err = errClosed
+	return nil
+}
@@ -0,0 +1,48 @@
+package huffman
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// readXattrs returns extended attributes of named file.
+func readXattrs(name string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(name, nil)
+	if err == syscall.ENOTSUP || size == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]byte, size)
+	if size, err = syscall.Listxattr(name, list); err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, attr := range bytes.Split(list[:size], []byte{0}) {
+		if len(attr) == 0 {
+			continue
+		}
+		n, err := syscall.Getxattr(name, string(attr), nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(name, string(attr), value); err != nil {
+			return nil, err
+		}
+		xattrs[string(attr)] = value[:n]
+	}
+	return xattrs, nil
+}
+
+// writeXattrs sets extended attributes of named file.
+func writeXattrs(name string, xattrs map[string][]byte) error {
+	for attr, value := range xattrs {
+		if err := syscall.Setxattr(name, attr, value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
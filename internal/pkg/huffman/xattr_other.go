@@ -0,0 +1,15 @@
+//go:build !linux
+
+package huffman
+
+import "errors"
+
+// readXattrs returns no attributes, as extended attributes are not supported on this system.
+func readXattrs(name string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// writeXattrs fails, as extended attributes are not supported on this system.
+func writeXattrs(name string, xattrs map[string][]byte) error {
+	return errors.New("extended attributes are not supported on this system")
+}
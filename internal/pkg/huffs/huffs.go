@@ -0,0 +1,257 @@
+package huffs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// Ext is the extension of encoded files.
+const Ext = ".huf"
+
+// FS serves files of underlying file system, decoding name+Ext in place of name.
+// Directory listings show encoded files under their original names.
+type FS struct {
+	fsys fs.FS
+}
+
+// New returns FS reading files from fsys.
+func New(fsys fs.FS) *FS {
+	return &FS{fsys: fsys}
+}
+
+// Open opens named file, decoding name+Ext if it exists.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	encoded, err := fsys.openEncoded(name)
+	if err == nil {
+		return encoded, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	f, err := fsys.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dir{File: f, fsys: fsys, name: name}, nil
+	}
+	return f, nil
+}
+
+// ReadDir reads named directory, see FS.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.decodeEntries(name, entries), nil
+}
+
+// openEncoded opens name+Ext, returning fs.ErrNotExist if it is not a regular file.
+func (fsys *FS) openEncoded(name string) (*file, error) {
+	if name == "." {
+		return nil, fs.ErrNotExist
+	}
+
+	f, err := fsys.fsys.Open(name + Ext)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+
+	// Random access needs io.ReaderAt, so read other files into memory
+	ra, ok := f.(io.ReaderAt)
+	size := info.Size()
+	if !ok {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	r, err := huffman.NewReaderAt(ra, size)
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &file{f: f, r: r, info: fileInfo{info, r.Size()}}, nil
+}
+
+// decodeEntries replaces encoded files with entries of their original names.
+// Encoded file takes place of plain file with the same name, as in Open.
+func (fsys *FS) decodeEntries(dirName string, entries []fs.DirEntry) []fs.DirEntry {
+	encoded := make(map[string]bool)
+	for _, e := range entries {
+		if name := e.Name(); strings.HasSuffix(name, Ext) && len(name) > len(Ext) && e.Type().IsRegular() {
+			encoded[strings.TrimSuffix(name, Ext)] = true
+		}
+	}
+
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case encoded[name]:
+			continue
+		case strings.HasSuffix(name, Ext) && encoded[strings.TrimSuffix(name, Ext)]:
+			name = strings.TrimSuffix(name, Ext)
+			result = append(result, &dirEntry{e, fsys, joinPath(dirName, name), name})
+		default:
+			result = append(result, e)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result
+}
+
+// joinPath joins directory and name of its entry.
+func joinPath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// file is opened encoded file.
+type file struct {
+	f    fs.File
+	r    *huffman.ReaderAt
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	return f.r.ReadAt(p, off)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	return f.r.Seek(offset, whence)
+}
+
+func (f *file) Close() error {
+	return f.f.Close()
+}
+
+// fileInfo describes encoded file by its original name and size.
+type fileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi fileInfo) Name() string {
+	return strings.TrimSuffix(fi.FileInfo.Name(), Ext)
+}
+
+func (fi fileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi fileInfo) Sys() interface{} {
+	return nil
+}
+
+// dir is opened directory with decoded listing.
+type dir struct {
+	fs.File
+	fsys *FS
+	name string
+
+	entries []fs.DirEntry // Entries left to return, nil until first ReadDir
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		rd, ok := d.File.(fs.ReadDirFile)
+		if !ok {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: errors.New("not implemented")}
+		}
+		entries, err := rd.ReadDir(-1)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = d.fsys.decodeEntries(d.name, entries)
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = d.entries[len(d.entries):]
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// dirEntry is entry of encoded file listed under its original name.
+type dirEntry struct {
+	fs.DirEntry
+	fsys *FS
+	path string
+	name string
+}
+
+func (e *dirEntry) Name() string {
+	return e.name
+}
+
+// Info opens encoded file to find out its original size.
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	f, err := e.fsys.openEncoded(e.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.info, nil
+}
+
+var (
+	_ fs.ReadDirFS   = (*FS)(nil)
+	_ fs.ReadDirFile = (*dir)(nil)
+	_ io.ReadSeeker  = (*file)(nil)
+)
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/icza/bitio"
+)
+
+// ScaleBits is log2 of the sum of scaled frequencies.
+const ScaleBits = 15
+
+// Total is the sum of scaled frequencies of a non-empty model.
+const Total = 1 << ScaleBits
+
+// Model holds symbol frequencies scaled so that they sum up to Total.
+// It is used by arithmetic and rANS coders.
+type Model struct {
+	symbols []uint32       // Present symbols in ascending order
+	freq    []uint32       // Scaled frequency of each symbol
+	start   []uint32       // Sum of frequencies of preceding symbols
+	index   map[uint32]int // Position of symbol in symbols
+	slots   []uint16       // Maps cumulative frequency to position in symbols
+}
+
+// New constructs model from symbol frequencies.
+// Every present symbol gets scaled frequency of at least 1,
+// so there can be no more than Total symbols.
+func New(freq map[uint32]uint) (*Model, error) {
+	m := &Model{}
+	if len(freq) == 0 {
+		return m, nil
+	}
+	if len(freq) > Total {
+		return nil, fmt.Errorf("too many symbols for model: %d > %d", len(freq), Total)
+	}
+
+	var total uint64
+	for s, f := range freq {
+		m.symbols = append(m.symbols, s)
+		total += uint64(f)
+	}
+	sort.Slice(m.symbols, func(i, j int) bool { return m.symbols[i] < m.symbols[j] })
+
+	// Scale frequencies, keeping every symbol representable
+	m.freq = make([]uint32, len(m.symbols))
+	var sum uint32
+	largest := 0
+	for i, s := range m.symbols {
+		f := uint32(uint64(freq[s]) * Total / total)
+		if f == 0 {
+			f = 1
+		}
+		m.freq[i] = f
+		sum += f
+		if m.freq[i] > m.freq[largest] {
+			largest = i
+		}
+	}
+
+	// Fix rounding errors
+	for sum > Total {
+		i := largest
+		for j := range m.freq {
+			if m.freq[j] > m.freq[i] {
+				i = j
+			}
+		}
+		m.freq[i]--
+		sum--
+	}
+	m.freq[largest] += Total - sum
+
+	m.build()
+	return m, nil
+}
+
+// build fills cumulative frequencies and lookup tables.
+func (m *Model) build() {
+	m.start = make([]uint32, len(m.symbols))
+	m.slots = make([]uint16, Total)
+	m.index = make(map[uint32]int, len(m.symbols))
+
+	var cum uint32
+	for i, s := range m.symbols {
+		m.index[s] = i
+		m.start[i] = cum
+		for j := cum; j < cum+m.freq[i]; j++ {
+			m.slots[j] = uint16(i)
+		}
+		cum += m.freq[i]
+	}
+}
+
+// Len returns number of symbols in model.
+func (m *Model) Len() int {
+	return len(m.symbols)
+}
+
+// Lookup returns cumulative and own frequency of symbol.
+func (m *Model) Lookup(sym uint32) (start, freq uint32) {
+	i := m.index[sym]
+	return m.start[i], m.freq[i]
+}
+
+// Find returns symbol which cumulative frequency range contains slot.
+func (m *Model) Find(slot uint32) (sym, start, freq uint32) {
+	i := m.slots[slot]
+	return m.symbols[i], m.start[i], m.freq[i]
+}
+
+// WriteHeader writes model in a form which can be read by ReadModel.
+// Symbols are written using width bits.
+//
+// Header: uint16 (number of symbols)
+//
+//	symbol and uint16 scaled frequency for every symbol
+func (m *Model) WriteHeader(w *bitio.Writer, width uint8) error {
+	w.TryWriteBitsUnsafe(uint64(len(m.symbols)), 16)
+	for i, s := range m.symbols {
+		w.TryWriteBitsUnsafe(uint64(s), width)
+		w.TryWriteBitsUnsafe(uint64(m.freq[i]), 16)
+	}
+	return w.TryError
+}
+
+// ReadModel reads model written by WriteHeader.
+// Symbols are read using width bits.
+func ReadModel(r *bitio.Reader, width uint8) (*Model, error) {
+	u, err := r.ReadBits(16)
+	if err != nil {
+		return nil, err
+	}
+
+	n := int(u)
+	m := &Model{
+		symbols: make([]uint32, n),
+		freq:    make([]uint32, n),
+	}
+	if n == 0 {
+		return m, nil
+	}
+
+	var sum uint32
+	for i := 0; i < n; i++ {
+		if u, err = r.ReadBits(width); err != nil {
+			return nil, err
+		}
+		m.symbols[i] = uint32(u)
+		if i > 0 && m.symbols[i] <= m.symbols[i-1] {
+			return nil, errors.New("model symbols are not sorted")
+		}
+
+		if u, err = r.ReadBits(16); err != nil {
+			return nil, err
+		}
+		if u == 0 || u > Total {
+			return nil, errors.New("bad symbol frequency in model")
+		}
+		m.freq[i] = uint32(u)
+		sum += m.freq[i]
+	}
+
+	if sum != Total {
+		return nil, errors.New("model frequencies do not sum up to total")
+	}
+
+	m.build()
+	return m, nil
+}
@@ -0,0 +1,436 @@
+package parity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/cravtos/huffman/internal/pkg/rs"
+)
+
+// Layout:
+//
+//	header, repeated 3 times: magic, uint8 (parity symbols of codeword), uint8 (depth)
+//	stripes, each: data, parity
+//
+// Every stripe but the last one holds depth*(rs.MaxLen-parity) bytes of data,
+// and byte i of stripe data belongs to codeword i%depth.
+// Parity of codewords follows data interleaved the same way, so burst error
+// of up to depth*parity/2 bytes is corrected.
+// The last stripe holds the rest of data in shorter codewords.
+const (
+	Magic      = "HUFR"
+	headerSize = 4 + 1 + 1
+	HeaderSize = 3 * headerSize
+
+	// Depth is the number of codewords interleaved in a stripe.
+	Depth = 64
+)
+
+// ErrCorrupted is returned when stripe has more errors than can be corrected.
+var ErrCorrupted = errors.New("parity: too many errors to correct")
+
+// Symbols returns number of parity symbols of codeword for redundancy given in percents.
+func Symbols(percent int) int {
+	return rs.MaxLen * percent / 100 &^ 1
+}
+
+// layout holds parameters of parity stream.
+type layout struct {
+	codec *rs.Codec
+	depth int
+}
+
+// newLayout returns layout with given number of parity symbols per codeword.
+func newLayout(parity, depth int) (layout, error) {
+	if depth == 0 {
+		return layout{}, errors.New("parity: zero depth")
+	}
+	codec, err := rs.New(parity)
+	return layout{codec, depth}, err
+}
+
+// dataSize returns amount of data of full stripe.
+func (l layout) dataSize() int {
+	return l.depth * (rs.MaxLen - l.codec.Parity())
+}
+
+// stripeSize returns size of stripe holding n bytes of data.
+func (l layout) stripeSize(n int) int {
+	codewords := l.depth
+	if n < codewords {
+		codewords = n
+	}
+	return n + codewords*l.codec.Parity()
+}
+
+// lastData returns amount of data of the last stripe of given size.
+func (l layout) lastData(size int) (int, error) {
+	p := l.codec.Parity()
+	n := size / (1 + p)
+	if size >= l.depth*(1+p) {
+		n = size - l.depth*p
+	}
+	if n <= 0 || l.stripeSize(n) != size {
+		return 0, fmt.Errorf("parity: bad size of last stripe %d", size)
+	}
+	return n, nil
+}
+
+// encode appends parity of stripe data to it.
+func (l layout) encode(stripe []byte) []byte {
+	n := len(stripe)
+	p := l.codec.Parity()
+	codewords := l.depth
+	if n < codewords {
+		codewords = n
+	}
+
+	data := make([]byte, 0, rs.MaxLen)
+	parity := make([]byte, p)
+	stripe = append(stripe, make([]byte, codewords*p)...)
+	for c := 0; c < codewords; c++ {
+		data = data[:0]
+		for i := c; i < n; i += l.depth {
+			data = append(data, stripe[i])
+		}
+		l.codec.Encode(data, parity)
+		for j, s := range parity {
+			stripe[n+j*codewords+c] = s
+		}
+	}
+	return stripe
+}
+
+// decode corrects errors of stripe holding n bytes of data in place.
+// Returns number of corrected symbols. Codewords with too many errors are left as they are.
+func (l layout) decode(stripe []byte, n int) (int, error) {
+	p := l.codec.Parity()
+	codewords := l.depth
+	if n < codewords {
+		codewords = n
+	}
+
+	corrected := 0
+	var err error
+	codeword := make([]byte, 0, rs.MaxLen)
+	for c := 0; c < codewords; c++ {
+		codeword = codeword[:0]
+		for i := c; i < n; i += l.depth {
+			codeword = append(codeword, stripe[i])
+		}
+		for j := 0; j < p; j++ {
+			codeword = append(codeword, stripe[n+j*codewords+c])
+		}
+
+		k, cerr := l.codec.Decode(codeword)
+		if cerr != nil {
+			err = ErrCorrupted
+		}
+		if k == 0 {
+			continue
+		}
+		corrected += k
+
+		for i, j := c, 0; i < n; i, j = i+l.depth, j+1 {
+			stripe[i] = codeword[j]
+		}
+		for j := 0; j < p; j++ {
+			stripe[n+j*codewords+c] = codeword[len(codeword)-p+j]
+		}
+	}
+	return corrected, err
+}
+
+// encodeHeader returns stream header.
+func (l layout) encodeHeader() []byte {
+	var head []byte
+	for i := 0; i < 3; i++ {
+		head = append(head, Magic...)
+		head = append(head, byte(l.codec.Parity()), byte(l.depth))
+	}
+	return head
+}
+
+// voteHeader returns header taking every byte agreed by at least two copies.
+func voteHeader(head []byte) []byte {
+	voted := make([]byte, headerSize)
+	for i := range voted {
+		a, b, c := head[i], head[headerSize+i], head[2*headerSize+i]
+		voted[i] = a
+		if b == c {
+			voted[i] = b
+		}
+	}
+	return voted
+}
+
+// Detect reports whether head, at least HeaderSize bytes long, starts parity stream.
+func Detect(head []byte) bool {
+	return len(head) >= HeaderSize && string(voteHeader(head)[:len(Magic)]) == Magic
+}
+
+// parseHeader returns layout stored in stream header.
+func parseHeader(head []byte) (layout, error) {
+	if !Detect(head) {
+		return layout{}, errors.New("parity: not a parity stream")
+	}
+	voted := voteHeader(head)
+	return newLayout(int(voted[4]), int(voted[5]))
+}
+
+// Writer adds parity to data written to it.
+// Data is written to the underlying writer by whole stripes.
+type Writer struct {
+	w      io.Writer
+	layout layout
+	buf    []byte
+	err    error
+}
+
+// NewWriter returns Writer adding parity of given redundancy in percents
+// and writes stream header to w.
+func NewWriter(w io.Writer, percent int) (*Writer, error) {
+	l, err := newLayout(Symbols(percent), Depth)
+	if err != nil {
+		return nil, err
+	}
+
+	pw := &Writer{w: w, layout: l}
+	pw.buf = make([]byte, 0, l.stripeSize(l.dataSize()))
+	_, pw.err = w.Write(l.encodeHeader())
+	return pw, pw.err
+}
+
+// Write buffers p and writes every filled stripe.
+func (pw *Writer) Write(p []byte) (n int, err error) {
+	size := pw.layout.dataSize()
+	for len(p) > 0 && pw.err == nil {
+		k := copy(pw.buf[len(pw.buf):size], p)
+		pw.buf = pw.buf[:len(pw.buf)+k]
+		n += k
+		p = p[k:]
+
+		if len(pw.buf) == size {
+			pw.err = pw.writeStripe()
+		}
+	}
+	return n, pw.err
+}
+
+// writeStripe writes buffered data with its parity.
+func (pw *Writer) writeStripe() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	_, err := pw.w.Write(pw.layout.encode(pw.buf))
+	pw.buf = pw.buf[:0]
+	return err
+}
+
+// Close writes the last stripe. It does not close the underlying writer.
+func (pw *Writer) Close() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	pw.err = pw.writeStripe()
+	if pw.err != nil {
+		return pw.err
+	}
+	pw.err = errors.New("parity: write to closed stream")
+	return nil
+}
+
+// Reader corrects errors of stream written by Writer and reads its data.
+type Reader struct {
+	r         io.Reader
+	layout    layout
+	buf       []byte
+	data      []byte // Corrected data not read yet
+	corrected int
+	err       error
+}
+
+// NewReader returns Reader of parity stream read from r.
+// Stream header is read immediately.
+func NewReader(r io.Reader) (*Reader, error) {
+	head := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	l, err := parseHeader(head)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{r: r, layout: l, buf: make([]byte, l.stripeSize(l.dataSize()))}, nil
+}
+
+// Corrected returns number of symbols corrected so far.
+func (pr *Reader) Corrected() int {
+	return pr.corrected
+}
+
+// Read reads corrected data, reading next stripe when needed.
+func (pr *Reader) Read(p []byte) (n int, err error) {
+	for len(pr.data) == 0 && pr.err == nil {
+		pr.err = pr.nextStripe()
+	}
+
+	n = copy(p, pr.data)
+	pr.data = pr.data[n:]
+	if len(pr.data) == 0 && n > 0 {
+		return n, nil
+	}
+	return n, pr.err
+}
+
+// nextStripe reads and corrects next stripe.
+func (pr *Reader) nextStripe() error {
+	size, err := io.ReadFull(pr.r, pr.buf)
+	n := pr.layout.dataSize()
+	switch err {
+	case nil:
+	case io.ErrUnexpectedEOF:
+		if n, err = pr.layout.lastData(size); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	k, err := pr.layout.decode(pr.buf[:size], n)
+	pr.corrected += k
+	if err != nil {
+		return err
+	}
+	pr.data = pr.buf[:n]
+	return nil
+}
+
+// ReaderAt gives random access to data of parity stream,
+// correcting only stripes holding requested bytes.
+type ReaderAt struct {
+	r       io.ReaderAt
+	layout  layout
+	size    int64 // Size of data
+	stripes int64 // Number of stripes
+	last    int   // Amount of data of the last stripe
+
+	// Raw makes uncorrectable stripes read as they are instead of failing
+	Raw bool
+
+	mu        sync.Mutex
+	cached    int64 // Number of cached stripe, -1 if none
+	data      []byte
+	corrected map[int64]int // Number of symbols corrected in every decoded stripe
+}
+
+// NewReaderAt returns ReaderAt of parity stream of given size.
+func NewReaderAt(r io.ReaderAt, size int64) (*ReaderAt, error) {
+	head := make([]byte, HeaderSize)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	l, err := parseHeader(head)
+	if err != nil {
+		return nil, err
+	}
+
+	full := int64(l.stripeSize(l.dataSize()))
+	size -= HeaderSize
+	ra := &ReaderAt{
+		r:       r,
+		layout:  l,
+		stripes: size / full,
+		last:    l.dataSize(),
+		cached:  -1,
+
+		corrected: make(map[int64]int),
+	}
+	if rest := int(size % full); rest != 0 {
+		if ra.last, err = l.lastData(rest); err != nil {
+			return nil, err
+		}
+		ra.stripes++
+	}
+	if ra.stripes > 0 {
+		ra.size = (ra.stripes-1)*int64(l.dataSize()) + int64(ra.last)
+	}
+
+	return ra, nil
+}
+
+// Size returns size of data.
+func (ra *ReaderAt) Size() int64 {
+	return ra.size
+}
+
+// Corrected returns number of symbols corrected so far.
+// Stripes decoded more than once are counted once.
+func (ra *ReaderAt) Corrected() int {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	n := 0
+	for _, k := range ra.corrected {
+		n += k
+	}
+	return n
+}
+
+// ReadAt reads len(p) bytes of data starting at offset off.
+// It is safe to call ReadAt concurrently.
+func (ra *ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("parity: negative offset")
+	}
+
+	stripeData := int64(ra.layout.dataSize())
+	for n < len(p) && off < ra.size {
+		i := off / stripeData
+		data, err := ra.stripe(i)
+		if err != nil {
+			return n, err
+		}
+
+		k := copy(p[n:], data[off-i*stripeData:])
+		n += k
+		off += int64(k)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// stripe returns corrected data of i-th stripe.
+func (ra *ReaderAt) stripe(i int64) ([]byte, error) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	if ra.cached == i {
+		return ra.data, nil
+	}
+
+	n := ra.layout.dataSize()
+	if i == ra.stripes-1 {
+		n = ra.last
+	}
+	full := int64(ra.layout.stripeSize(ra.layout.dataSize()))
+	buf := make([]byte, ra.layout.stripeSize(n))
+	if _, err := ra.r.ReadAt(buf, HeaderSize+i*full); err != nil {
+		return nil, err
+	}
+
+	k, err := ra.layout.decode(buf, n)
+	ra.corrected[i] = k
+	if err != nil && !ra.Raw {
+		return nil, fmt.Errorf("stripe %d: %v", i, err)
+	}
+
+	ra.cached, ra.data = i, buf[:n]
+	return ra.data, nil
+}
@@ -0,0 +1,102 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// barWidth is the width of bar in characters.
+const barWidth = 30
+
+// interval is the minimum time between redraws.
+const interval = 100 * time.Millisecond
+
+// Bar draws progress bar with throughput and ETA on a terminal.
+type Bar struct {
+	w     io.Writer
+	label string
+	start time.Time
+	last  time.Time // Time of last redraw
+	drawn bool      // Whether anything is drawn
+}
+
+// New returns Bar drawn to w with given label.
+func New(w io.Writer, label string) *Bar {
+	return &Bar{w: w, label: label, start: time.Now()}
+}
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update redraws bar if enough time passed since last redraw or the job is done.
+// Total is -1 if unknown.
+func (b *Bar) Update(done, total int64) {
+	now := time.Now()
+	if now.Sub(b.last) < interval && done != total {
+		return
+	}
+	b.last = now
+	b.drawn = true
+
+	elapsed := now.Sub(b.start).Seconds()
+	var speed float64
+	if elapsed > 0 {
+		speed = float64(done) / elapsed
+	}
+
+	var line string
+	if total > 0 {
+		if done > total {
+			done = total
+		}
+		filled := int(barWidth * done / total)
+		eta := "--:--"
+		if speed > 0 {
+			eta = formatDuration(float64(total-done) / speed)
+		}
+		line = fmt.Sprintf("%s [%s%s] %3d%% %s/s ETA %s", b.label,
+			strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled),
+			100*done/total, formatSize(speed), eta)
+	} else {
+		line = fmt.Sprintf("%s %s %s/s", b.label, formatSize(float64(done)), formatSize(speed))
+	}
+
+	// Clear rest of the previous line
+	fmt.Fprintf(b.w, "\r%s\033[K", line)
+}
+
+// Finish moves cursor to the next line if bar was drawn.
+func (b *Bar) Finish() {
+	if b.drawn {
+		fmt.Fprintln(b.w)
+	}
+}
+
+// formatSize formats amount of bytes using binary prefixes.
+func formatSize(n float64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	i := -1
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", n, units[i])
+}
+
+// formatDuration formats seconds as [h:]mm:ss.
+func formatDuration(sec float64) string {
+	s := int64(sec + 0.5)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
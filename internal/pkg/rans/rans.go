@@ -0,0 +1,74 @@
+package rans
+
+import (
+	"errors"
+
+	"github.com/cravtos/huffman/internal/pkg/model"
+)
+
+// lowerBound is the lower bound of normalized coder state.
+const lowerBound = 1 << 23
+
+// Encode does rANS coding of symbols using model m.
+//
+// Symbols are encoded in reverse order, so that decoder can read output forward.
+func Encode(m *model.Model, data []uint32) []byte {
+	var out []byte
+	var x uint32 = lowerBound
+
+	for i := len(data) - 1; i >= 0; i-- {
+		start, freq := m.Lookup(data[i])
+
+		// Renormalize state so that it stays in bounds after encoding
+		xMax := ((lowerBound >> model.ScaleBits) << 8) * freq
+		for x >= xMax {
+			out = append(out, byte(x))
+			x >>= 8
+		}
+
+		x = (x/freq)<<model.ScaleBits + x%freq + start
+	}
+
+	// Flush final state
+	out = append(out, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+
+	// Reverse output
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return out
+}
+
+// Decode decodes n symbols from buf using model m.
+func Decode(buf []byte, m *model.Model, n int) ([]uint32, error) {
+	if len(buf) < 4 {
+		return nil, errors.New("rans: stream is too short")
+	}
+
+	x := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16 | uint32(buf[3])<<24
+	buf = buf[4:]
+
+	const mask = model.Total - 1
+	// n comes from untrusted header, so memory grows as symbols are decoded
+	size := n
+	if size > 1<<16 {
+		size = 1 << 16
+	}
+	data := make([]uint32, 0, size)
+	for len(data) < n {
+		sym, start, freq := m.Find(x & mask)
+		data = append(data, sym)
+
+		x = freq*(x>>model.ScaleBits) + x&mask - start
+		for x < lowerBound {
+			if len(buf) == 0 {
+				return nil, errors.New("rans: unexpected end of stream")
+			}
+			x = x<<8 | uint32(buf[0])
+			buf = buf[1:]
+		}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,123 @@
+package rle
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// MinRun is the shortest number of repeats replaced with run symbol.
+const MinRun = 4
+
+// Classes is the number of run symbols.
+// Run symbol base+k stands for 2^k..2^(k+1)-1 repeats of previous symbol,
+// exact number is given by k extra bits.
+const Classes = 32
+
+// Run is a run of repeats replaced by run symbol.
+type Run struct {
+	Class uint8  // Number of extra bits
+	Extra uint32 // Number of repeats minus 2^Class
+}
+
+// Len returns number of repeats.
+func (r Run) Len() uint32 {
+	return 1<<r.Class + r.Extra
+}
+
+// newRun returns run of n repeats.
+func newRun(n uint32) Run {
+	class := uint8(bits.Len32(n) - 1)
+	return Run{Class: class, Extra: n - 1<<class}
+}
+
+// Encode replaces every MinRun or more repeats of a symbol with run symbol base+class,
+// where base is greater than any symbol.
+// Returns new symbols and runs in order of their appearance.
+func Encode(symbols []uint32, base uint32) (out []uint32, runs []Run) {
+	out = make([]uint32, 0, len(symbols))
+
+	for i := 0; i < len(symbols); {
+		s := symbols[i]
+		out = append(out, s)
+
+		// Count repeats of s
+		j := i + 1
+		for j < len(symbols) && symbols[j] == s {
+			j++
+		}
+		n := uint32(j - i - 1)
+
+		if n >= MinRun {
+			r := newRun(n)
+			out = append(out, base+uint32(r.Class))
+			runs = append(runs, r)
+		} else {
+			for k := uint32(0); k < n; k++ {
+				out = append(out, s)
+			}
+		}
+
+		i = j
+	}
+
+	return out, runs
+}
+
+// Decode replaces run symbols with repeats of previous symbol.
+// extra is called for every run symbol to get its extra bits.
+// Decoding fails if more than max symbols would be produced.
+func Decode(symbols []uint32, base uint32, max int, extra func(class uint8) (uint32, error)) ([]uint32, error) {
+	out := make([]uint32, 0, len(symbols))
+
+	for _, s := range symbols {
+		if s < base {
+			out = append(out, s)
+			continue
+		}
+
+		if s-base >= Classes {
+			return nil, errors.New("rle: bad run symbol")
+		}
+		if len(out) == 0 {
+			return nil, errors.New("rle: run without symbol to repeat")
+		}
+
+		class := uint8(s - base)
+		e, err := extra(class)
+		if err != nil {
+			return nil, err
+		}
+		if e >= 1<<class {
+			return nil, errors.New("rle: bad run length")
+		}
+
+		r := Run{Class: class, Extra: e}
+		if uint64(len(out))+uint64(r.Len()) > uint64(max) {
+			return nil, errors.New("rle: too many symbols")
+		}
+		prev := out[len(out)-1]
+		for k := uint32(0); k < r.Len(); k++ {
+			out = append(out, prev)
+		}
+	}
+
+	return out, nil
+}
+
+// Worth reports whether at least one tenth of symbols would be removed by Encode.
+func Worth(symbols []uint32) bool {
+	var removed int
+
+	for i := 0; i < len(symbols); {
+		j := i + 1
+		for j < len(symbols) && symbols[j] == symbols[i] {
+			j++
+		}
+		if n := j - i - 1; n >= MinRun {
+			removed += n - 1
+		}
+		i = j
+	}
+
+	return removed*10 >= len(symbols) && removed > 0
+}
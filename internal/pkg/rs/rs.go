@@ -0,0 +1,244 @@
+package rs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxLen is the maximum length of codeword in symbols.
+const MaxLen = 255
+
+// ErrTooManyErrors is returned when codeword has more errors than can be corrected.
+var ErrTooManyErrors = errors.New("rs: too many errors")
+
+// Arithmetic of GF(2^8) with primitive polynomial x^8+x^4+x^3+x^2+1.
+// exp is doubled, so products of logarithms need no reduction.
+var (
+	exp [2 * MaxLen]byte
+	log [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < MaxLen; i++ {
+		exp[i], exp[i+MaxLen] = byte(x), byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return exp[int(log[a])+int(log[b])]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return exp[int(log[a])+MaxLen-int(log[b])]
+}
+
+// pow returns alpha^n.
+func pow(n int) byte {
+	return exp[n%MaxLen]
+}
+
+// inv returns 1/a.
+func inv(a byte) byte {
+	return exp[MaxLen-int(log[a])]
+}
+
+// Codec is a Reed-Solomon code over GF(2^8) with fixed number of parity symbols.
+// Codewords are data followed by parity, no longer than MaxLen in total.
+// Shorter codewords are shortened codes, as if data was padded with leading zeros.
+type Codec struct {
+	parity int
+	gen    []byte // Generator polynomial, highest degree first
+}
+
+// New returns Codec adding given number of parity symbols,
+// which corrects up to parity/2 erroneous symbols of every codeword.
+func New(parity int) (*Codec, error) {
+	if parity < 2 || parity >= MaxLen {
+		return nil, fmt.Errorf("rs: number of parity symbols must be between 2 and %d, got %d", MaxLen-1, parity)
+	}
+
+	// gen = (x - alpha^0)(x - alpha^1)...(x - alpha^(parity-1))
+	gen := []byte{1}
+	for i := 0; i < parity; i++ {
+		next := make([]byte, len(gen)+1)
+		for j, g := range gen {
+			next[j] ^= g
+			next[j+1] ^= mul(g, pow(i))
+		}
+		gen = next
+	}
+
+	return &Codec{parity: parity, gen: gen}, nil
+}
+
+// Parity returns number of parity symbols of every codeword.
+func (c *Codec) Parity() int {
+	return c.parity
+}
+
+// Encode computes parity of data, which must not be longer than MaxLen-Parity(),
+// and writes it to parity.
+func (c *Codec) Encode(data, parity []byte) {
+	parity = parity[:c.parity]
+	for i := range parity {
+		parity[i] = 0
+	}
+
+	// Remainder of data*x^parity divided by generator
+	for _, d := range data {
+		fb := d ^ parity[0]
+		copy(parity, parity[1:])
+		parity[len(parity)-1] = 0
+		if fb == 0 {
+			continue
+		}
+		for i := range parity {
+			parity[i] ^= mul(fb, c.gen[i+1])
+		}
+	}
+}
+
+// Decode corrects errors of codeword in place
+// and returns number of corrected symbols.
+func (c *Codec) Decode(codeword []byte) (int, error) {
+	n := len(codeword)
+	if n <= c.parity || n > MaxLen {
+		return 0, fmt.Errorf("rs: bad codeword length %d", n)
+	}
+
+	// Syndromes, all zero when there are no errors
+	synd := make([]byte, c.parity)
+	clean := true
+	for j := range synd {
+		var s byte
+		a := pow(j)
+		for _, r := range codeword {
+			s = mul(s, a) ^ r
+		}
+		synd[j] = s
+		clean = clean && s == 0
+	}
+	if clean {
+		return 0, nil
+	}
+
+	locator, nErrors := berlekampMassey(synd)
+	if len(locator)-1 != nErrors || 2*nErrors > c.parity {
+		return 0, ErrTooManyErrors
+	}
+
+	// Evaluator = syndromes * locator mod x^parity
+	eval := make([]byte, c.parity)
+	for i := range eval {
+		for j := 0; j <= i && j < len(locator); j++ {
+			eval[i] ^= mul(locator[j], synd[i-j])
+		}
+	}
+
+	// Find error positions by roots of locator, and their values by Forney algorithm
+	type fix struct {
+		pos int
+		val byte
+	}
+	fixes := make([]fix, 0, nErrors)
+	for pos := 0; pos < n; pos++ {
+		x := pow(n - 1 - pos) // Error locator of symbol
+		xInv := inv(x)
+		if evalPoly(locator, xInv) != 0 {
+			continue
+		}
+
+		// Formal derivative of locator keeps odd terms only
+		var deriv byte
+		for i := 1; i < len(locator); i += 2 {
+			deriv ^= mul(locator[i], powOf(xInv, i-1))
+		}
+		if deriv == 0 {
+			return 0, ErrTooManyErrors
+		}
+		fixes = append(fixes, fix{pos, mul(x, div(evalPoly(eval, xInv), deriv))})
+	}
+	if len(fixes) != nErrors {
+		return 0, ErrTooManyErrors
+	}
+
+	for _, f := range fixes {
+		codeword[f.pos] ^= f.val
+	}
+	return len(fixes), nil
+}
+
+// berlekampMassey returns error locator polynomial for syndromes,
+// lowest degree first and without trailing zeros, and number of errors.
+// Degree of valid locator equals number of errors.
+func berlekampMassey(synd []byte) ([]byte, int) {
+	loc, prev := []byte{1}, []byte{1}
+	l, m, b := 0, 1, byte(1)
+
+	for n := range synd {
+		d := synd[n]
+		for i := 1; i <= l && i < len(loc); i++ {
+			d ^= mul(loc[i], synd[n-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+
+		// loc -= d/b * x^m * prev
+		size := len(loc)
+		if len(prev)+m > size {
+			size = len(prev) + m
+		}
+		next := make([]byte, size)
+		copy(next, loc)
+		coef := div(d, b)
+		for i, p := range prev {
+			next[i+m] ^= mul(coef, p)
+		}
+
+		if 2*l <= n {
+			l, prev, b, m = n+1-l, loc, d, 1
+		} else {
+			m++
+		}
+		loc = next
+	}
+
+	for len(loc) > 1 && loc[len(loc)-1] == 0 {
+		loc = loc[:len(loc)-1]
+	}
+	return loc, l
+}
+
+// evalPoly evaluates polynomial with lowest degree first at x.
+func evalPoly(p []byte, x byte) byte {
+	var y byte
+	for i := len(p) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ p[i]
+	}
+	return y
+}
+
+// powOf returns x^n.
+func powOf(x byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if x == 0 {
+		return 0
+	}
+	return exp[int(log[x])*n%MaxLen]
+}
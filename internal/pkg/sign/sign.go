@@ -0,0 +1,297 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Trailer layout, appended to signed file or written to detached signature file:
+//
+//	magic, uint8 (algEd25519), public key, signature, magic
+//
+// Signature covers context, trailer up to signature and SHA-256 of signed file,
+// so it can be verified while file is read sequentially.
+// Detached signature covers file without its trailer, if there is one.
+const (
+	Magic       = "HUFS"
+	TrailerSize = 4 + 1 + ed25519.PublicKeySize + ed25519.SignatureSize + 4
+
+	// Ext is the extension of detached signature file.
+	Ext = ".sig"
+
+	algEd25519 = 1
+	context    = "huffman signature v1\x00"
+)
+
+var (
+	// ErrUnsigned is returned when signature is required, but file is not signed.
+	ErrUnsigned = errors.New("sign: file is not signed")
+	// ErrBadSignature is returned when signature does not match file or key.
+	ErrBadSignature = errors.New("sign: invalid signature")
+)
+
+// message returns signed message of trailer and hash of file.
+func message(trailer []byte, sum []byte) []byte {
+	msg := append([]byte(context), trailer[:4+1+ed25519.PublicKeySize]...)
+	return append(msg, sum...)
+}
+
+// IsTrailer reports whether b is a signature trailer.
+func IsTrailer(b []byte) bool {
+	return len(b) == TrailerSize &&
+		string(b[:4]) == Magic && b[4] == algEd25519 &&
+		string(b[TrailerSize-4:]) == Magic
+}
+
+// Sign returns trailer with signature of data read from r.
+func Sign(priv ed25519.PrivateKey, r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	trailer := make([]byte, 0, TrailerSize)
+	trailer = append(trailer, Magic...)
+	trailer = append(trailer, algEd25519)
+	trailer = append(trailer, priv.Public().(ed25519.PublicKey)...)
+	trailer = append(trailer, ed25519.Sign(priv, message(trailer, h.Sum(nil)))...)
+	return append(trailer, Magic...), nil
+}
+
+// verify checks trailer of data with given hash against public key.
+func verify(pub ed25519.PublicKey, trailer, sum []byte) error {
+	if trailer == nil {
+		return ErrUnsigned
+	}
+	if !IsTrailer(trailer) {
+		return fmt.Errorf("%w: bad trailer", ErrBadSignature)
+	}
+
+	signer := ed25519.PublicKey(trailer[5 : 5+ed25519.PublicKeySize])
+	if !bytes.Equal(signer, pub) {
+		return fmt.Errorf("%w: signed by another key %s", ErrBadSignature, Fingerprint(signer))
+	}
+	sig := trailer[5+ed25519.PublicKeySize : TrailerSize-4]
+	if !ed25519.Verify(pub, message(trailer, sum), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Verify checks signature trailer of data read from r against public key.
+func Verify(pub ed25519.PublicKey, r io.Reader, trailer []byte) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	return verify(pub, trailer, h.Sum(nil))
+}
+
+// VerifyFile checks signature trailer of named file, or detached signature
+// read from sigPath or name+Ext, against public key.
+func VerifyFile(name, sigPath string, pub ed25519.PublicKey) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return VerifyOpenFile(f, sigPath, pub)
+}
+
+// VerifyOpenFile is like VerifyFile, but checks already opened file, so the
+// same file is read afterwards. Offset of f is not changed.
+func VerifyOpenFile(f *os.File, sigPath string, pub ed25519.PublicKey) error {
+	name := f.Name()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size, trailer, err := Split(f, stat.Size())
+	if err != nil {
+		return err
+	}
+
+	if sigPath == "" && trailer == nil {
+		if _, err := os.Stat(name + Ext); err == nil {
+			sigPath = name + Ext
+		}
+	}
+	if sigPath != "" {
+		if trailer, err = ioutil.ReadFile(sigPath); err != nil {
+			return err
+		}
+	}
+
+	return Verify(pub, io.NewSectionReader(f, 0, size), trailer)
+}
+
+// Split returns size of signed data of file of given size and its trailer,
+// or nil trailer if file is not signed.
+func Split(r io.ReaderAt, size int64) (int64, []byte, error) {
+	if size < TrailerSize {
+		return size, nil, nil
+	}
+
+	trailer := make([]byte, TrailerSize)
+	if _, err := r.ReadAt(trailer, size-TrailerSize); err != nil {
+		return 0, nil, err
+	}
+	if !IsTrailer(trailer) {
+		return size, nil, nil
+	}
+	return size - TrailerSize, trailer, nil
+}
+
+// Fingerprint returns short hex identifier of public key.
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Reader reads file without its signature trailer and hashes read data,
+// so signature can be verified once the whole file is read.
+type Reader struct {
+	r       io.Reader
+	buf     []byte // Data read from r and not returned yet
+	hash    hash.Hash
+	trailer []byte // Signature trailer, set at the end of file
+	err     error  // Error of r, io.EOF at the end of file
+}
+
+// NewReader returns Reader of file read from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, hash: sha256.New(), buf: make([]byte, 0, 32*1024)}
+}
+
+// Read reads data of file. The last TrailerSize bytes are held back
+// until the end of file to check whether they are a trailer.
+func (sr *Reader) Read(p []byte) (int, error) {
+	for sr.err == nil && len(sr.buf) <= TrailerSize {
+		if len(sr.buf) == cap(sr.buf) {
+			sr.buf = append(sr.buf, 0)[:len(sr.buf)]
+		}
+		n, err := sr.r.Read(sr.buf[len(sr.buf):cap(sr.buf)])
+		sr.buf = sr.buf[:len(sr.buf)+n]
+		sr.err = err
+	}
+
+	hold := TrailerSize
+	if sr.err != nil {
+		hold = 0
+		if n := len(sr.buf) - TrailerSize; n >= 0 && IsTrailer(sr.buf[n:]) && sr.trailer == nil {
+			sr.trailer = append([]byte(nil), sr.buf[n:]...)
+			sr.buf = sr.buf[:n]
+		}
+	}
+	if hold > len(sr.buf) {
+		hold = len(sr.buf)
+	}
+
+	n := copy(p, sr.buf[:len(sr.buf)-hold])
+	sr.hash.Write(sr.buf[:n])
+	sr.buf = append(sr.buf[:0], sr.buf[n:]...)
+	if len(sr.buf) == 0 && n == 0 {
+		return 0, sr.err
+	}
+	return n, nil
+}
+
+// Verify reads the rest of file and checks its signature against public key.
+// Detached signature is used instead of trailer if it is not nil.
+func (sr *Reader) Verify(pub ed25519.PublicKey, detached []byte) error {
+	if _, err := io.Copy(ioutil.Discard, sr); err != nil {
+		return err
+	}
+
+	trailer := sr.trailer
+	if detached != nil {
+		trailer = detached
+	}
+	return verify(pub, trailer, sr.hash.Sum(nil))
+}
+
+// Private and public keys are stored in PEM encoded PKCS #8 and PKIX form.
+const (
+	privateKeyType = "PRIVATE KEY"
+	publicKeyType  = "PUBLIC KEY"
+)
+
+// MarshalPrivateKey returns PEM encoding of private key.
+func MarshalPrivateKey(priv ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: privateKeyType, Bytes: der}), nil
+}
+
+// MarshalPublicKey returns PEM encoding of public key.
+func MarshalPublicKey(pub ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: publicKeyType, Bytes: der}), nil
+}
+
+// ParsePrivateKey parses PEM encoded Ed25519 private key.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != privateKeyType {
+		return nil, errors.New("sign: no private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("sign: not an Ed25519 private key")
+	}
+	return priv, nil
+}
+
+// ParsePublicKey parses PEM encoded Ed25519 public key.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != publicKeyType {
+		return nil, errors.New("sign: no public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("sign: not an Ed25519 public key")
+	}
+	return pub, nil
+}
+
+// ReadPublicKey reads PEM encoded Ed25519 public key from file.
+func ReadPublicKey(name string) (ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
+
+// ReadPrivateKey reads PEM encoded Ed25519 private key from file.
+func ReadPrivateKey(name string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(data)
+}
@@ -0,0 +1,65 @@
+package token
+
+import "fmt"
+
+// MaxLen is the maximum length of a token. Longer runs are split.
+const MaxLen = 1<<16 - 1
+
+// isWord reports whether b belongs to a word.
+// Bytes of multibyte UTF-8 sequences are treated as letters.
+func isWord(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= 0x80
+}
+
+// Split splits text into words (runs of letters and digits)
+// and separators (runs of any other bytes).
+func Split(data []byte) [][]byte {
+	var tokens [][]byte
+
+	for len(data) > 0 {
+		n := 1
+		for n < len(data) && n < MaxLen && isWord(data[n]) == isWord(data[0]) {
+			n++
+		}
+		tokens = append(tokens, data[:n])
+		data = data[n:]
+	}
+
+	return tokens
+}
+
+// Tokenize splits text into tokens and replaces every token with its index in dictionary.
+// Tokens are added to dictionary in order of their first appearance.
+func Tokenize(data []byte) (dict [][]byte, symbols []uint32) {
+	index := make(map[string]uint32)
+
+	for _, t := range Split(data) {
+		i, ok := index[string(t)]
+		if !ok {
+			i = uint32(len(dict))
+			index[string(t)] = i
+			dict = append(dict, t)
+		}
+		symbols = append(symbols, i)
+	}
+
+	return dict, symbols
+}
+
+// Join replaces every symbol with token from dictionary.
+// Joining fails if data would be longer than max.
+func Join(dict [][]byte, symbols []uint32, max int) ([]byte, error) {
+	var data []byte
+
+	for _, s := range symbols {
+		if int(s) >= len(dict) {
+			return nil, fmt.Errorf("symbol %d is out of dictionary of size %d", s, len(dict))
+		}
+		if len(data)+len(dict[s]) > max {
+			return nil, fmt.Errorf("joined tokens are longer than %d bytes", max)
+		}
+		data = append(data, dict[s]...)
+	}
+
+	return data, nil
+}
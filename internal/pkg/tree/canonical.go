@@ -0,0 +1,269 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/icza/bitio"
+)
+
+// MaxCodeLen is the maximum length of code which fits code.Code.
+const MaxCodeLen = 64
+
+// NewLimitedTree constructs encoding tree from symbol frequencies
+// with codes not longer than maxLen bits.
+// Frequencies are halved until the tree is shallow enough.
+func NewLimitedTree(freq map[uint32]uint, maxLen int) (*Node, error) {
+	if maxLen < 1 || maxLen > MaxCodeLen {
+		return nil, fmt.Errorf("bad maximum code length %d", maxLen)
+	}
+	if maxLen < 32 && len(freq) > 1<<maxLen {
+		return nil, fmt.Errorf("%d symbols do not fit codes of %d bits", len(freq), maxLen)
+	}
+
+	root := NewEncodingTree(freq)
+	for root.depth() > maxLen {
+		flat := make(map[uint32]uint, len(freq))
+		for s, f := range freq {
+			flat[s] = (f + 1) / 2
+		}
+		freq = flat
+		root = NewEncodingTree(freq)
+	}
+
+	return root, nil
+}
+
+// depth returns length of the longest code in tree.
+func (head *Node) depth() int {
+	if head == nil || head.left == nil && head.right == nil {
+		return 0
+	}
+
+	l, r := head.left.depth(), head.right.depth()
+	if l > r {
+		return l + 1
+	}
+	return r + 1
+}
+
+// CodeLengths returns length of code of every symbol in tree.
+func (head *Node) CodeLengths() map[uint32]uint8 {
+	lengths := make(map[uint32]uint8)
+	for s, c := range head.NewEncodingTable() {
+		lengths[s] = c.Len
+	}
+	return lengths
+}
+
+// canonicalOrder returns symbols sorted by code length, then by value.
+func canonicalOrder(lengths map[uint32]uint8) []uint32 {
+	symbols := make([]uint32, 0, len(lengths))
+	for s := range lengths {
+		symbols = append(symbols, s)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		li, lj := lengths[symbols[i]], lengths[symbols[j]]
+		if li != lj {
+			return li < lj
+		}
+		return symbols[i] < symbols[j]
+	})
+	return symbols
+}
+
+// NewCanonicalTree constructs tree of canonical codes of given lengths.
+// Codes of the same length are consecutive numbers in order of symbol values,
+// and shorter codes precede longer ones, so lengths alone define the codes.
+func NewCanonicalTree(lengths map[uint32]uint8) (*Node, error) {
+	if len(lengths) == 0 {
+		return nil, nil
+	}
+
+	symbols := canonicalOrder(lengths)
+	if len(symbols) == 1 {
+		if lengths[symbols[0]] != 0 {
+			return nil, errors.New("single symbol must have empty code")
+		}
+		return &Node{value: symbols[0]}, nil
+	}
+
+	root := &Node{}
+	var c uint64
+	prevLen := lengths[symbols[0]]
+	for i, s := range symbols {
+		l := lengths[s]
+		if l == 0 || l > MaxCodeLen {
+			return nil, fmt.Errorf("bad code length %d of symbol %d", l, s)
+		}
+
+		if i > 0 {
+			c++
+			if c == 0 {
+				return nil, errors.New("code lengths are over-subscribed")
+			}
+		}
+		c <<= l - prevLen
+		prevLen = l
+		if l < 64 && c>>l != 0 {
+			return nil, errors.New("code lengths are over-subscribed")
+		}
+
+		if err := root.insertCode(s, c, l); err != nil {
+			return nil, err
+		}
+	}
+
+	if !root.complete() {
+		return nil, errors.New("code lengths are incomplete")
+	}
+	return root, nil
+}
+
+// insertCode puts leaf with symbol s at path given by code c of length l.
+func (head *Node) insertCode(s uint32, c uint64, l uint8) error {
+	node := head
+	for i := int(l) - 1; i >= 0; i-- {
+		if node.weight != 0 {
+			return errors.New("code is prefixed by another code")
+		}
+
+		child := &node.left
+		if c>>uint(i)&1 == 1 {
+			child = &node.right
+		}
+		if *child == nil {
+			*child = &Node{}
+		}
+		node = *child
+	}
+
+	if node.left != nil || node.right != nil || node.weight != 0 {
+		return errors.New("code is used twice")
+	}
+	node.value = s
+	node.weight = 1 // Marks leaf as taken
+	return nil
+}
+
+// complete reports whether every inner node of tree has both children.
+func (head *Node) complete() bool {
+	if head.left == nil && head.right == nil {
+		return true
+	}
+	if head.left == nil || head.right == nil {
+		return false
+	}
+	return head.left.complete() && head.right.complete()
+}
+
+// WriteCanonicalHeader writes header which can be used to construct
+// tree of canonical codes with the same lengths as codes of head.
+// Symbols are written using width bits.
+//
+// Header: uint32 (number of encoded symbols in file)
+//
+//	7 bits (maximum code length)
+//	for every length from 1 to maximum: number of codes of this length in width+1 bits
+//	symbols in canonical order, width bits each
+//
+// If tree has at most one symbol, maximum code length is zero
+// and it is followed by one bit telling whether the symbol is present.
+func (head *Node) WriteCanonicalHeader(w *bitio.Writer, freq map[uint32]uint, width uint8) error {
+	var nEncoded uint32
+	for _, v := range freq {
+		nEncoded += uint32(v)
+	}
+	w.TryWriteBitsUnsafe(uint64(nEncoded), 32)
+
+	lengths := head.CodeLengths()
+	symbols := canonicalOrder(lengths)
+
+	if len(symbols) <= 1 {
+		w.TryWriteBitsUnsafe(0, 7)
+		w.TryWriteBool(len(symbols) == 1)
+		for _, s := range symbols {
+			w.TryWriteBitsUnsafe(uint64(s), width)
+		}
+		return w.TryError
+	}
+
+	maxLen := lengths[symbols[len(symbols)-1]]
+	counts := make([]uint64, maxLen+1)
+	for _, l := range lengths {
+		counts[l]++
+	}
+
+	w.TryWriteBitsUnsafe(uint64(maxLen), 7)
+	for _, n := range counts[1:] {
+		w.TryWriteBitsUnsafe(n, width+1)
+	}
+	for _, s := range symbols {
+		w.TryWriteBitsUnsafe(uint64(s), width)
+	}
+	return w.TryError
+}
+
+// DecodeCanonicalHeader reads header written by WriteCanonicalHeader.
+// Returns constructed tree and number of encoded symbols.
+func DecodeCanonicalHeader(r *bitio.Reader, width uint8) (nEncoded uint32, root *Node, err error) {
+	u, err := r.ReadBits(32)
+	if err != nil {
+		return 0, nil, err
+	}
+	nEncoded = uint32(u)
+
+	u, err = r.ReadBits(7)
+	if err != nil {
+		return 0, nil, err
+	}
+	maxLen := uint8(u)
+	if maxLen > MaxCodeLen {
+		return 0, nil, fmt.Errorf("bad maximum code length %d", maxLen)
+	}
+
+	if maxLen == 0 {
+		present, err := r.ReadBool()
+		if err != nil || !present {
+			return nEncoded, nil, err
+		}
+		s, err := r.ReadBits(width)
+		if err != nil {
+			return 0, nil, err
+		}
+		return nEncoded, &Node{value: uint32(s)}, nil
+	}
+
+	// Read number of codes of every length
+	counts := make([]uint64, maxLen+1)
+	var total uint64
+	for l := 1; l <= int(maxLen); l++ {
+		if counts[l], err = r.ReadBits(width + 1); err != nil {
+			return 0, nil, err
+		}
+		total += counts[l]
+		if total > 1<<width {
+			return 0, nil, errors.New("too many symbols in header")
+		}
+	}
+
+	lengths := make(map[uint32]uint8)
+	for l := 1; l <= int(maxLen); l++ {
+		for i := uint64(0); i < counts[l]; i++ {
+			s, err := r.ReadBits(width)
+			if err != nil {
+				return 0, nil, err
+			}
+			if _, ok := lengths[uint32(s)]; ok {
+				return 0, nil, fmt.Errorf("symbol %d is repeated", s)
+			}
+			lengths[uint32(s)] = uint8(l)
+		}
+	}
+
+	if root, err = NewCanonicalTree(lengths); err != nil {
+		return 0, nil, err
+	}
+	return nEncoded, root, nil
+}
@@ -0,0 +1,129 @@
+package tree
+
+import (
+	"errors"
+)
+
+// maxTableBits limits number of bits looked up at once by Decoder.
+const maxTableBits = 11
+
+// entry is a decoding table entry. Codes of at most tableBits bits are
+// decoded by a single lookup; longer ones continue from node.
+type entry struct {
+	value uint32
+	len   uint8 // Length of code, zero if it is longer than tableBits
+	node  *Node // Node reached after tableBits bits of longer code
+}
+
+// Decoder decodes codes of tree by looking up their first bits in a table
+// instead of walking the tree bit by bit.
+type Decoder struct {
+	root  *Node
+	bits  uint8 // Number of bits looked up at once
+	table []entry
+}
+
+// NewDecoder returns Decoder of codes of tree.
+func (head *Node) NewDecoder() *Decoder {
+	d := &Decoder{root: head}
+	if head == nil || head.IsLeaf() {
+		return d
+	}
+
+	d.bits = maxTableBits
+	if depth := head.depth(); depth < int(d.bits) {
+		d.bits = uint8(depth)
+	}
+	d.table = make([]entry, 1<<d.bits)
+	d.fill(head, 0, 0)
+	return d
+}
+
+// fill fills entries of codes starting with prefix of given length which lead to node.
+func (d *Decoder) fill(node *Node, prefix uint32, length uint8) {
+	if node.IsLeaf() || length == d.bits {
+		e := entry{value: node.value, len: length}
+		if !node.IsLeaf() {
+			e = entry{node: node}
+		}
+
+		// Every entry whose first length bits are prefix
+		shift := d.bits - length
+		for i := prefix << shift; i < (prefix+1)<<shift; i++ {
+			d.table[i] = e
+		}
+		return
+	}
+	d.fill(node.left, prefix<<1, length+1)
+	d.fill(node.right, prefix<<1|1, length+1)
+}
+
+// BitReader reads bits of byte slice starting from the most significant bit,
+// the same way as bitio.Reader.
+type BitReader struct {
+	data []byte
+	pos  int    // Next byte to load
+	acc  uint64 // Loaded bits, aligned to the most significant bit
+	n    uint8  // Number of loaded bits
+}
+
+// NewBitReader returns BitReader reading data.
+func NewBitReader(data []byte) *BitReader {
+	return &BitReader{data: data}
+}
+
+// refill loads bytes until at least 57 bits are loaded or data ends.
+func (br *BitReader) refill() {
+	for br.n <= 56 && br.pos < len(br.data) {
+		br.acc |= uint64(br.data[br.pos]) << (56 - br.n)
+		br.pos++
+		br.n += 8
+	}
+}
+
+// Next decodes next symbol from br.
+func (d *Decoder) Next(br *BitReader) (uint32, error) {
+	if d.root == nil {
+		return 0, errors.New("symbol decoded by empty tree")
+	}
+	if d.table == nil {
+		return d.root.value, nil
+	}
+
+	if br.n < d.bits {
+		br.refill()
+	}
+	e := d.table[br.acc>>(64-d.bits)]
+	if e.node == nil {
+		if e.len > br.n {
+			return 0, errors.New("unexpected end of stream")
+		}
+		br.acc <<= e.len
+		br.n -= e.len
+		return e.value, nil
+	}
+	if d.bits > br.n {
+		return 0, errors.New("unexpected end of stream")
+	}
+	br.acc <<= d.bits
+	br.n -= d.bits
+
+	// Code is longer than table, walk the rest of it
+	node := e.node
+	for !node.IsLeaf() {
+		if br.n == 0 {
+			br.refill()
+			if br.n == 0 {
+				return 0, errors.New("unexpected end of stream")
+			}
+		}
+		if br.acc>>63 == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+		br.acc <<= 1
+		br.n--
+	}
+	return node.value, nil
+}
@@ -2,6 +2,8 @@ package tree
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 
 	"github.com/cravtos/huffman/internal/pkg/code"
 	"github.com/icza/bitio"
@@ -9,23 +11,41 @@ import (
 
 // Node represents node in encoding tree.
 type Node struct {
-	value       byte
+	value       uint32
 	weight      uint
 	left, right *Node
 	next, prev  *Node
 }
 
-// NewEncodingTree constructs encoding tree from byte frequencies.
+// NewEncodingTree constructs encoding tree from symbol frequencies.
 // Returns root node.
-func NewEncodingTree(freq map[uint8]uint) *Node {
+//
+// The tree depends only on frequencies: leaves are ordered by weight, then by symbol value,
+// and a joined node is placed after nodes of the same weight.
+func NewEncodingTree(freq map[uint32]uint) *Node {
 	var head Node // Fictitious head
 
-	for i, v := range freq {
+	symbols := make([]uint32, 0, len(freq))
+	for s := range freq {
+		symbols = append(symbols, s)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if freq[symbols[i]] != freq[symbols[j]] {
+			return freq[symbols[i]] < freq[symbols[j]]
+		}
+		return symbols[i] < symbols[j]
+	})
+
+	// Symbols are sorted, so appending them keeps the list sorted
+	tail := &head
+	for _, s := range symbols {
 		node := &Node{
-			value:  i,
-			weight: v,
+			value:  s,
+			weight: freq[s],
+			prev:   tail,
 		}
-		head.insert(node)
+		tail.next = node
+		tail = node
 	}
 
 	for head.next != nil && head.next.next != nil {
@@ -82,20 +102,21 @@ func (head *Node) fillTable(table code.Table, c code.Code) {
 }
 
 // WriteHeader writes header which can be used to construct encoding tree.
+// Symbols are written using width bits.
 //
 // Header: uint32 (number of encoded symbols in file)
-//		   uint8 (number of symbols in tree)
+//		   uint32 (number of symbols in tree)
 //		   tree in raw bits
 //
 // To store the tree, we use a post-order traversal, writing each node visited.
-// When you encounter a leaf node, you write a 1 followed by the byte value of the leaf node.
+// When you encounter a leaf node, you write a 1 followed by the symbol value of the leaf node.
 // When you encounter a non-leaf node, you write a 0.
 // To indicate the end of the Huffman coding tree, we write another 0.
 //
 // For the string "streets are stone stars are not",
 // the header information is "1t1a1r001n1o01 01e1s0000", followed by the encoded text.
 // (https://engineering.purdue.edu/ece264/17au/hw/HW13/resources//streetstar.jpg)
-func (head *Node) WriteHeader(w *bitio.Writer, freq map[uint8]uint) (err error) {
+func (head *Node) WriteHeader(w *bitio.Writer, freq map[uint32]uint, width uint8) (err error) {
 	var nEncoded uint32
 	for _, v := range freq {
 		nEncoded += uint32(v)
@@ -105,35 +126,35 @@ func (head *Node) WriteHeader(w *bitio.Writer, freq map[uint8]uint) (err error)
 	w.TryWriteBitsUnsafe(uint64(nEncoded), 32)
 
 	// Write total number of symbols in graph
-	w.TryWriteBitsUnsafe(uint64(len(freq)), 8)
+	w.TryWriteBitsUnsafe(uint64(len(freq)), 32)
 
 	// Write encoding tree information
-	if err = head.writeHeader(w); err != nil {
+	if err = head.writeHeader(w, width); err != nil {
 		return err
 	}
 	w.TryWriteBitsUnsafe(0, 1)
 	return w.TryError
 }
 
-func (head *Node) writeHeader(w *bitio.Writer) (err error) {
+func (head *Node) writeHeader(w *bitio.Writer, width uint8) (err error) {
 	if head == nil {
 		return
 	}
 
 	if head.left == nil && head.right == nil {
 		w.TryWriteBitsUnsafe(1, 1)
-		w.TryWriteByte(head.value)
+		w.TryWriteBitsUnsafe(uint64(head.value), width)
 		return w.TryError
 	}
 
 	if head.left != nil {
-		if err = head.left.writeHeader(w); err != nil {
+		if err = head.left.writeHeader(w, width); err != nil {
 			return err
 		}
 	}
 
 	if head.right != nil {
-		if err = head.right.writeHeader(w); err != nil {
+		if err = head.right.writeHeader(w, width); err != nil {
 			return err
 		}
 	}
@@ -143,9 +164,9 @@ func (head *Node) writeHeader(w *bitio.Writer) (err error) {
 }
 
 // DecodeHeader reads from bitio.Reader total number of encoded symbols,
-// number of leaf in tree, the tree itself.
+// number of leaf in tree, the tree itself. Symbols are read using width bits.
 // Returns constructed tree and number of encoded symbols.
-func DecodeHeader(r *bitio.Reader) (nEncoded uint32, root *Node, err error) {
+func DecodeHeader(r *bitio.Reader, width uint8) (nEncoded uint32, root *Node, err error) {
 	var buf uint64
 	buf, err = r.ReadBits(32)
 	nEncoded = uint32(buf)
@@ -153,13 +174,13 @@ func DecodeHeader(r *bitio.Reader) (nEncoded uint32, root *Node, err error) {
 		return 0, nil, err
 	}
 
-	buf, err = r.ReadBits(8)
-	nTree := byte(buf)
+	buf, err = r.ReadBits(32)
+	nTree := uint32(buf)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	root, err = decodeTree(r, nTree)
+	root, err = decodeTree(r, nTree, width)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -167,11 +188,16 @@ func DecodeHeader(r *bitio.Reader) (nEncoded uint32, root *Node, err error) {
 	return nEncoded, root, nil
 }
 
-// decodeTree constructs tree from header information
-func decodeTree(r *bitio.Reader, nTree byte) (root *Node, err error) {
-	var head Node
-	var nodes byte
-	var leaves byte
+// decodeTree constructs tree from header information.
+// Nodes are kept on a stack, every inner node joins two topmost ones.
+func decodeTree(r *bitio.Reader, nTree uint32, width uint8) (root *Node, err error) {
+	if width < 32 && uint64(nTree) > 1<<width {
+		return nil, fmt.Errorf("too many symbols in tree: %d", nTree)
+	}
+
+	var stack []*Node
+	var nodes uint32
+	var leaves uint32
 	var u uint64
 
 	for nodes < nTree {
@@ -182,34 +208,39 @@ func decodeTree(r *bitio.Reader, nTree byte) (root *Node, err error) {
 
 		if u == 1 {
 			leaves++
-			symbol, err := r.ReadBits(8)
+			if leaves > nTree {
+				return nil, errors.New("too many leaves in tree")
+			}
+			symbol, err := r.ReadBits(width)
 			if err != nil {
 				return nil, err
 			}
-			node := &Node{value: byte(symbol)}
-			head.pushBack(node)
+			stack = append(stack, &Node{value: uint32(symbol)})
+			continue
 		}
 
-		if u == 0 {
-			nodes++
-			if nodes == nTree {
-				break
-			}
-			r := head.popLast()
-			l := head.popLast()
-			node := join(l, r)
-			head.pushBack(node)
+		nodes++
+		if nodes == nTree {
+			break
+		}
+		if len(stack) < 2 {
+			return nil, errors.New("inner node without two children")
 		}
+		n := len(stack)
+		stack = append(stack[:n-2], join(stack[n-2], stack[n-1]))
 	}
 
-	if nodes != leaves {
-		err = errors.New("nodes != leaves")
+	if nodes != leaves || len(stack) > 1 {
+		return nil, errors.New("nodes != leaves")
 	}
-
-	return head.next, err
+	if len(stack) == 0 {
+		return nil, nil
+	}
+	return stack[0], nil
 }
 
 // insert puts a node to list so that the list remains sorted.
+// Node goes after nodes of the same weight.
 func (head *Node) insert(node *Node) {
 	if head == nil {
 		return
@@ -228,22 +259,6 @@ func (head *Node) insert(node *Node) {
 	after.next = node
 }
 
-// pushBack puts a node to the end of a list.
-func (head *Node) pushBack(node *Node) {
-	if head == nil {
-		return
-	}
-
-	after := head
-	for after.next != nil {
-		after = after.next
-	}
-
-	node.prev = after
-	node.next = nil
-	after.next = node
-}
-
 // popFirst removes first node after head and returns it.
 // If head is the only node, nil is returned.
 func (head *Node) popFirst() *Node {
@@ -267,28 +282,6 @@ func (head *Node) popFirst() *Node {
 	return node
 }
 
-// popLast removes first node after head and returns it.
-// If head is the only node, nil is returned.
-func (head *Node) popLast() *Node {
-	if head == nil {
-		return nil
-	}
-
-	node := head.next
-	if node == nil {
-		return nil
-	}
-
-	for node.next != nil {
-		node = node.next
-	}
-
-	node.prev.next = nil
-	node.prev = nil
-
-	return node
-}
-
 // join returns node with left and right leaves set to l and r.
 // Returned node weight is sum of l and r weights.
 func join(l, r *Node) *Node {
@@ -306,11 +299,17 @@ func join(l, r *Node) *Node {
 	return &node
 }
 
+// IsLeaf reports whether node has no children.
+// Symbols of tree consisting of a single leaf take no bits.
+func (head *Node) IsLeaf() bool {
+	return head != nil && head.left == nil && head.right == nil
+}
+
 // DecodeNext reads bits from Reader until reaching a leaf in encoding tree.
-// Returns code corresponding to leaf.
-func (head *Node) DecodeNext(r *bitio.Reader) (b byte, err error) {
+// Returns symbol corresponding to leaf.
+func (head *Node) DecodeNext(r *bitio.Reader) (s uint32, err error) {
 	if head == nil {
-		return
+		return 0, errors.New("symbol decoded by empty tree")
 	}
 
 	var u uint64
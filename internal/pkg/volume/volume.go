@@ -0,0 +1,369 @@
+package volume
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+)
+
+// Volume layout:
+//
+//	magic, set ID, uint32 (volume index, from 1), uint32 (number of volumes)
+//	part of data
+//
+// Volumes of a set are named name.001, name.002 and so on.
+// Number of volumes is written to every volume when the set is closed.
+const (
+	Magic      = "HUFV"
+	HeaderSize = 4 + idSize + 4 + 4
+
+	idSize = 16
+)
+
+// Name returns name of i-th volume of set.
+func Name(base string, i int) string {
+	return fmt.Sprintf("%s.%03d", base, i)
+}
+
+// BaseName returns name of set given name of any volume.
+func BaseName(name string) (string, bool) {
+	dot := strings.LastIndexByte(name, '.')
+	if dot < 0 {
+		return name, false
+	}
+	if _, err := strconv.Atoi(name[dot+1:]); err != nil || len(name)-dot-1 < 3 {
+		return name, false
+	}
+	return name[:dot], true
+}
+
+// Detect reports whether head starts a volume.
+func Detect(head []byte) bool {
+	return len(head) >= len(Magic) && string(head[:len(Magic)]) == Magic
+}
+
+// header is a header of volume.
+type header struct {
+	id    [idSize]byte
+	index uint32
+	count uint32
+}
+
+func (h header) encode() []byte {
+	b := make([]byte, HeaderSize)
+	copy(b, Magic)
+	copy(b[4:], h.id[:])
+	binary.BigEndian.PutUint32(b[4+idSize:], h.index)
+	binary.BigEndian.PutUint32(b[8+idSize:], h.count)
+	return b
+}
+
+// readHeader reads header of named volume.
+func readHeader(f *os.File, name string) (h header, err error) {
+	b := make([]byte, HeaderSize)
+	if _, err = io.ReadFull(f, b); err != nil || !Detect(b) {
+		return h, fmt.Errorf("%s is not a volume", name)
+	}
+	copy(h.id[:], b[4:])
+	h.index = binary.BigEndian.Uint32(b[4+idSize:])
+	h.count = binary.BigEndian.Uint32(b[8+idSize:])
+	if h.count == 0 {
+		return h, fmt.Errorf("volume %s is from unfinished set", name)
+	}
+	if h.index == 0 || h.index > h.count {
+		return h, fmt.Errorf("volume %s has bad index %d of %d", name, h.index, h.count)
+	}
+	return h, nil
+}
+
+// ParseSize parses size with optional suffix K, M or G (powers of 1000)
+// or Ki, Mi or Gi (powers of 1024), like 25M.
+func ParseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30},
+		{"K", 1e3}, {"M", 1e6}, {"G", 1e9},
+	}
+
+	orig, mult := s, int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSuffix(s, u.suffix), u.mult
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n > 1<<62/mult {
+		return 0, fmt.Errorf("bad size %q", orig)
+	}
+	return n * mult, nil
+}
+
+// Writer splits data written to it into volumes of fixed size.
+// Volumes are written to temporary files renamed to volume names
+// only when the whole set is closed.
+type Writer struct {
+	base  string
+	size  int64 // Maximum size of volume
+	force bool  // Overwrite existing volumes
+	h     header
+	files []*helpers.Output // Written volumes, the last one is current
+	left  int64             // Space left in current volume
+	total int64             // Size of all volumes
+	err   error
+}
+
+// Create returns Writer creating volumes base.001, base.002 and so on,
+// no larger than size bytes including header.
+// Existing volumes are overwritten only if force is set.
+func Create(base string, size int64, force bool) (*Writer, error) {
+	if size <= HeaderSize {
+		return nil, fmt.Errorf("volume size must be larger than %d bytes", HeaderSize)
+	}
+
+	vw := &Writer{base: base, size: size, force: force}
+	if _, err := io.ReadFull(rand.Reader, vw.h.id[:]); err != nil {
+		return nil, err
+	}
+	return vw, vw.next()
+}
+
+// next creates next volume.
+func (vw *Writer) next() error {
+	vw.h.index++
+	out, err := helpers.CreateOutput(Name(vw.base, int(vw.h.index)), vw.force)
+	if err != nil {
+		return err
+	}
+	vw.files = append(vw.files, out)
+
+	if _, err = out.Write(vw.h.encode()); err != nil {
+		return err
+	}
+	vw.left = vw.size - HeaderSize
+	vw.total += HeaderSize
+	return nil
+}
+
+// Write writes p to volumes, creating new ones when current is filled.
+func (vw *Writer) Write(p []byte) (n int, err error) {
+	for len(p) > 0 && vw.err == nil {
+		if vw.left == 0 {
+			if vw.err = vw.next(); vw.err != nil {
+				break
+			}
+		}
+
+		chunk := p
+		if int64(len(chunk)) > vw.left {
+			chunk = chunk[:vw.left]
+		}
+		var k int
+		k, vw.err = vw.files[len(vw.files)-1].Write(chunk)
+		n += k
+		p = p[k:]
+		vw.left -= int64(k)
+		vw.total += int64(k)
+	}
+	return n, vw.err
+}
+
+// Size returns total size of written volumes.
+func (vw *Writer) Size() int64 {
+	return vw.total
+}
+
+// Count returns number of written volumes.
+func (vw *Writer) Count() int {
+	return int(vw.h.index)
+}
+
+// Close writes number of volumes to every volume and renames them to volume names.
+// Nothing is left if it fails.
+func (vw *Writer) Close() error {
+	err := vw.err
+	vw.h.count = uint32(len(vw.files))
+	for i, out := range vw.files {
+		h := vw.h
+		h.index = uint32(i + 1)
+		if _, werr := out.WriteAt(h.encode(), 0); err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		vw.Abort()
+		return err
+	}
+
+	for i, out := range vw.files {
+		if err = out.Commit(); err != nil {
+			// Volumes renamed so far are of incomplete set
+			for _, done := range vw.files[:i] {
+				done.Close()
+				os.Remove(done.Name())
+			}
+			vw.files = vw.files[i+1:]
+			vw.Abort()
+			return err
+		}
+	}
+	for _, out := range vw.files {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	vw.files = nil
+	vw.err = errors.New("volume: write to closed set")
+	return err
+}
+
+// Abort removes every volume written so far.
+func (vw *Writer) Abort() {
+	for _, out := range vw.files {
+		out.Abort()
+	}
+	vw.files = nil
+	if vw.err == nil {
+		vw.err = errors.New("volume: write to closed set")
+	}
+}
+
+// Reader reads data of all volumes of a set in order.
+type Reader struct {
+	names []string
+	cur   *os.File
+	next  int   // Index of next volume to open
+	left  int64 // Amount of data not read yet
+	size  int64 // Size of all volumes
+}
+
+// Open opens set of volumes given name of any of them and checks that
+// all volumes are present and belong to the same set.
+func Open(name string) (*Reader, error) {
+	base, ok := BaseName(name)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a volume name", name)
+	}
+
+	first, err := os.Open(Name(base, 1))
+	if err != nil {
+		return nil, fmt.Errorf("volume %s is missing: %v", Name(base, 1), err)
+	}
+	h, err := readHeader(first, Name(base, 1))
+	first.Close()
+	if err != nil {
+		return nil, err
+	}
+	if h.index != 1 {
+		return nil, fmt.Errorf("volume %s is out of order: it is volume %d of %d", Name(base, 1), h.index, h.count)
+	}
+
+	vr := &Reader{}
+	for i := 1; i <= int(h.count); i++ {
+		size, err := vr.check(Name(base, i), i, h)
+		if err != nil {
+			return nil, err
+		}
+		vr.names = append(vr.names, Name(base, i))
+		vr.left += size - HeaderSize
+		vr.size += size
+	}
+	return vr, nil
+}
+
+// check checks header of i-th volume and returns its size.
+func (vr *Reader) check(name string, i int, first header) (int64, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("volume %s (%d of %d) is missing", name, i, first.count)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h, err := readHeader(f, name)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(h.id[:], first.id[:]) {
+		return 0, fmt.Errorf("volume %s belongs to another set %s", name, hex.EncodeToString(h.id[:4]))
+	}
+	if h.count != first.count {
+		return 0, fmt.Errorf("volume %s is from set of %d volumes, not %d", name, h.count, first.count)
+	}
+	if int(h.index) != i {
+		return 0, fmt.Errorf("volume %s is out of order: it is volume %d of %d", name, h.index, h.count)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// Read reads data of volumes, opening next volume when current one ends.
+func (vr *Reader) Read(p []byte) (int, error) {
+	for {
+		if vr.cur == nil {
+			if vr.next == len(vr.names) {
+				return 0, io.EOF
+			}
+			f, err := os.Open(vr.names[vr.next])
+			if err != nil {
+				return 0, err
+			}
+			if _, err = f.Seek(HeaderSize, io.SeekStart); err != nil {
+				f.Close()
+				return 0, err
+			}
+			vr.cur = f
+			vr.next++
+		}
+
+		n, err := vr.cur.Read(p)
+		vr.left -= int64(n)
+		if err == io.EOF {
+			vr.cur.Close()
+			vr.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Len returns amount of data not read yet.
+func (vr *Reader) Len() int {
+	return int(vr.left)
+}
+
+// Size returns total size of volumes.
+func (vr *Reader) Size() int64 {
+	return vr.size
+}
+
+// Close closes current volume.
+func (vr *Reader) Close() error {
+	if vr.cur == nil {
+		return nil
+	}
+	err := vr.cur.Close()
+	vr.cur = nil
+	return err
+}
@@ -0,0 +1,53 @@
+package zipcodec
+
+import (
+	"archive/zip"
+	"io"
+	"sync"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// Method is the zip compression method of Huffman coded entries.
+// It is not assigned by the zip specification, so only readers
+// which registered Decompressor can read such entries.
+const Method uint16 = 0x4846
+
+var once sync.Once
+
+// Register registers Compressor and Decompressor for Method in archive/zip,
+// so that every zip.Writer and zip.Reader can use it.
+// It is safe to call Register more than once.
+func Register() {
+	once.Do(func() {
+		zip.RegisterCompressor(Method, Compressor)
+		zip.RegisterDecompressor(Method, Decompressor)
+	})
+}
+
+// Compressor returns writer which encodes entry data to w.
+func Compressor(w io.Writer) (io.WriteCloser, error) {
+	return huffman.NewWriter(w, huffman.Options{})
+}
+
+// Decompressor returns reader which decodes entry data read from r.
+func Decompressor(r io.Reader) io.ReadCloser {
+	hr, err := huffman.NewReader(r)
+	if err != nil {
+		return errReader{err}
+	}
+	return hr
+}
+
+// errReader returns error on every read.
+type errReader struct {
+	err error
+}
+
+func (er errReader) Read([]byte) (int, error) {
+	return 0, er.err
+}
+
+func (er errReader) Close() error {
+	return nil
+}
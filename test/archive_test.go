@@ -0,0 +1,205 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cravtos/huffman/internal/pkg/archive"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestArchive packs a directory tree, extracts it and compares results to originals.
+func TestArchive(t *testing.T) {
+	src := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	files := map[string]string{
+		"a.txt":         "hello",
+		"sub/b.txt":     "world world world",
+		"sub/deep/c.go": "package c",
+		"empty":         "",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("sub/b.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "a.txt"), 0640|os.ModeSetuid); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := archive.Pack(&buf, src, huffman.Options{}); err != nil {
+		t.Fatalf("got error while packing: %v\n", err)
+	}
+
+	ar, err := archive.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("got error while reading archive: %v\n", err)
+	}
+
+	// Extract everything
+	dst := t.TempDir()
+	if err := ar.Extract(dst, nil, false); err != nil {
+		t.Fatalf("got error while extracting: %v\n", err)
+	}
+
+	for name, content := range files {
+		p := filepath.Join(dst, filepath.FromSlash(name))
+		got, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: content is %q, want %q", name, got, content)
+		}
+
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: metadata is %v %v", name, info.Mode(), info.ModTime())
+		}
+	}
+
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "sub/b.txt" {
+		t.Errorf("link is %q: %v", link, err)
+	}
+
+	// Extract single file
+	one := t.TempDir()
+	if err := ar.Extract(one, []string{"sub/deep/c.go"}, false); err != nil {
+		t.Fatalf("got error while extracting single file: %v\n", err)
+	}
+	if entries, _ := ioutil.ReadDir(one); len(entries) != 1 {
+		t.Errorf("extracted %d entries instead of one", len(entries))
+	}
+
+	// Setuid bit is restored only when asked
+	for _, special := range []bool{false, true} {
+		dir := t.TempDir()
+		if err := ar.Extract(dir, []string{"a.txt"}, special); err != nil {
+			t.Fatalf("got error while extracting: %v\n", err)
+		}
+		info, err := os.Stat(filepath.Join(dir, "a.txt"))
+		if err != nil || info.Mode()&os.ModeSetuid != 0 != special {
+			t.Errorf("special %v: got mode %v, %v", special, info.Mode(), err)
+		}
+	}
+}
+
+// TestArchiveTraversal checks that entries escaping destination are refused.
+func TestArchiveTraversal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archive.Entry
+		patch   string // Replaces "xx" in archive
+		badDir  bool   // Directory of archive is refused
+	}{
+		{"parent", []archive.Entry{{Path: "xx/evil", Type: archive.File}}, "..", false},
+		{"absolute", []archive.Entry{{Path: "xxetc", Type: archive.File}}, "/e", false},
+		{"symlink", []archive.Entry{{Path: "link", Type: archive.Symlink, Link: "../../etc"}}, "", false},
+		{"symlink-dotdot", []archive.Entry{{Path: "link", Type: archive.Symlink, Link: "sub/../../etc"}}, "", false},
+		{"symlink-chain", []archive.Entry{
+			{Path: "l2", Type: archive.Symlink, Link: "."},
+			{Path: "l1", Type: archive.Symlink, Link: "l2/victim"},
+		}, "", false},
+		{"duplicate", []archive.Entry{
+			{Path: "l1", Type: archive.Symlink, Link: "sub"},
+			{Path: "xx", Type: archive.Dir, Mode: 0777},
+		}, "l1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			aw, err := archive.NewWriter(&buf, huffman.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range tt.entries {
+				if err := aw.Add(e, bytes.NewReader([]byte("evil"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := aw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data := buf.Bytes()
+			if tt.patch != "" {
+				data = bytes.Replace(data, []byte("xx"), []byte(tt.patch), 1)
+				fixChecksum(data)
+			}
+
+			ar, err := archive.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil || tt.badDir {
+				if err == nil || !tt.badDir {
+					t.Fatalf("got error %v while reading archive", err)
+				}
+				return
+			}
+
+			dst := t.TempDir()
+			if err := ar.Extract(filepath.Join(dst, "out"), nil, false); err == nil {
+				t.Error("entry escaping destination was extracted")
+			}
+		})
+	}
+
+	// Directory entry does not follow symbolic link already in destination
+	var buf bytes.Buffer
+	aw, err := archive.NewWriter(&buf, huffman.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Add(archive.Entry{Path: "d", Type: archive.Dir, Mode: 0777}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ar, err := archive.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, victim := t.TempDir(), t.TempDir()
+	if err := os.Chmod(victim, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(victim, filepath.Join(dst, "d")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ar.Extract(dst, nil, false); err == nil {
+		t.Error("directory was extracted through symbolic link")
+	}
+	if info, err := os.Stat(victim); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("directory outside destination is changed: %v %v", info.Mode(), err)
+	}
+}
+
+// fixChecksum updates directory checksum in footer of patched archive.
+// Footer: uint64 (directory offset), uint32 (CRC-32 of directory), magic.
+func fixChecksum(data []byte) {
+	footer := data[len(data)-16:]
+	offset := binary.BigEndian.Uint64(footer)
+	binary.BigEndian.PutUint32(footer[8:], crc32.ChecksumIEEE(data[offset:len(data)-16]))
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// buildCommand builds command of package in ../cmd and returns path to its binary.
+func buildCommand(t *testing.T, name string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), name)
+	if out, err := exec.Command("go", "build", "-o", bin, "../cmd/"+name).CombinedOutput(); err != nil {
+		t.Fatalf("got error while building %s: %v\n%s", name, err, out)
+	}
+	return bin
+}
+
+// runCommand runs binary in dir and returns its standard output and exit code.
+func runCommand(t *testing.T, dir, bin string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return stdout.String(), exitErr.ExitCode()
+	case err != nil:
+		t.Fatalf("got error while running %s: %v\n", bin, err)
+	}
+	return stdout.String(), 0
+}
+
+// TestBatch encodes directory trees and lists of files with encode in batch mode.
+func TestBatch(t *testing.T) {
+	encode := buildCommand(t, "encode")
+	alice, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"src/a.txt":            alice,
+		"src/sub/b.txt":        alice[:1000],
+		"src/sub/deep/c.txt":   bytes.Repeat([]byte("c"), 5000),
+		"src/sub/deep/empty":   nil,
+		"src/encoded/skip.huf": []byte("not encoded again"),
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Directory tree is mirrored in output directory, whatever number of jobs is used
+	outputs := make(map[string][]byte)
+	for _, jobs := range []int{1, 4} {
+		out := "out" + strconv.Itoa(jobs)
+		summary, code := runCommand(t, dir, encode, "-r", "-outdir", out, "-j", strconv.Itoa(jobs), "src")
+		if code != 0 {
+			t.Fatalf("-j %d: got exit code %d\n%s", jobs, code, summary)
+		}
+		if !strings.Contains(summary, "4 encoded, 1 skipped, 0 failed") {
+			t.Errorf("-j %d: got summary\n%s", jobs, summary)
+		}
+
+		for name, content := range files {
+			p := filepath.Join(dir, out, filepath.FromSlash(name)) + ".huf"
+			enc, err := ioutil.ReadFile(p)
+			if strings.HasSuffix(name, ".huf") {
+				if err == nil {
+					t.Errorf("-j %d: %s is encoded again", jobs, name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("-j %d: %s is not encoded: %v", jobs, name, err)
+			}
+
+			var dec bytes.Buffer
+			if err := huffman.Decode(bytes.NewReader(enc), &dec); err != nil || !bytes.Equal(dec.Bytes(), content) {
+				t.Errorf("-j %d: %s is not decoded: %v", jobs, name, err)
+			}
+			if prev, ok := outputs[name]; ok && !bytes.Equal(prev, enc) {
+				t.Errorf("-j %d: %s differs from output of -j 1", jobs, name)
+			}
+			outputs[name] = enc
+		}
+	}
+
+	// Existing outputs are not overwritten
+	if summary, code := runCommand(t, dir, encode, "-r", "-outdir", "out1", "src"); code != 1 {
+		t.Errorf("got exit code %d instead of 1 for existing outputs\n%s", code, summary)
+	}
+
+	// Files which can not be read fail alone
+	summary, code := runCommand(t, dir, encode, "-outdir", "partial", "src/a.txt", "src/missing.txt", "src/sub")
+	if code != 2 {
+		t.Errorf("got exit code %d instead of 2 for partial failure\n%s", code, summary)
+	}
+	if !strings.Contains(summary, "1 encoded, 0 skipped, 2 failed") {
+		t.Errorf("got summary\n%s", summary)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partial", "a.txt.huf")); err != nil {
+		t.Errorf("readable file is not encoded: %v", err)
+	}
+
+	// Globs are expanded
+	summary, code = runCommand(t, dir, encode, "-outdir", "glob", "src/sub/deep/*")
+	if code != 0 || !strings.Contains(summary, "2 encoded") {
+		t.Errorf("got exit code %d\n%s", code, summary)
+	}
+	if summary, code = runCommand(t, dir, encode, "-outdir", "glob", "src/*.none"); code != 1 {
+		t.Errorf("got exit code %d instead of 1 for glob matching nothing\n%s", code, summary)
+	}
+}
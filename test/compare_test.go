@@ -0,0 +1,57 @@
+package test
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestCompare runs huffman compare on alice.txt and checks its report.
+func TestCompare(t *testing.T) {
+	bin := buildCommand(t, "huffman")
+	input, err := filepath.Abs("./testdata/alice.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, code := runCommand(t, t.TempDir(), bin, "compare", input)
+	if code != 0 {
+		t.Fatalf("got exit code %d\n%s", code, report)
+	}
+
+	rows := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(report), "\n") {
+		fields := strings.Fields(line)
+		rows[fields[0]] = fields[1:]
+	}
+	if header := rows["method"]; len(header) != 3 || header[1] != "container" {
+		t.Fatalf("got header %v", header)
+	}
+
+	entropy, err := strconv.ParseFloat(rows["entropy"][1], 64)
+	if err != nil {
+		t.Fatalf("got entropy %v: %v", rows["entropy"], err)
+	}
+	for _, method := range huffman.Methods() {
+		for _, name := range []string{method.String(), method.String() + "/words"} {
+			row := rows[name]
+			if len(row) != 2 {
+				t.Fatalf("%s: got row %v", name, row)
+			}
+			size, err := strconv.Atoi(row[0])
+			if err != nil || size <= 0 {
+				t.Errorf("%s: got size %q", name, row[0])
+			}
+			bpb, err := strconv.ParseFloat(row[1], 64)
+			if err != nil || bpb <= 0 || bpb > 8 {
+				t.Errorf("%s: got %q bits per byte", name, row[1])
+			}
+			if !strings.HasSuffix(name, "/words") && bpb < entropy {
+				t.Errorf("%s: %.4f bits per byte is below entropy %.4f", name, bpb, entropy)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestContext checks cancellation and progress reporting of encoding and decoding.
+func TestContext(t *testing.T) {
+	alice, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	// Check that progress grows and reaches total
+	var calls int
+	var last int64
+	progress := func(done, total int64) {
+		calls++
+		if done < last || total != -1 && done > total {
+			t.Errorf("bad progress %d/%d after %d", done, total, last)
+		}
+		last = done
+	}
+
+	var encoded bytes.Buffer
+	opts := huffman.Options{BlockSize: 4096, Progress: progress}
+	if err := huffman.EncodeContext(context.Background(), bytes.NewReader(alice), &encoded, opts); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+	if want := (len(alice) + 4095) / 4096; calls != want || last != int64(len(alice)) {
+		t.Errorf("encoding progress: %d calls, last %d", calls, last)
+	}
+
+	calls, last = 0, 0
+	var decoded bytes.Buffer
+	decOpts := huffman.DecodeOptions{Progress: progress}
+	if err := huffman.DecodeContext(context.Background(), bytes.NewReader(encoded.Bytes()), &decoded, decOpts); err != nil {
+		t.Fatalf("got error while decoding: %v\n", err)
+	}
+	if calls == 0 || last != int64(encoded.Len()) {
+		t.Errorf("decoding progress: %d calls, last %d of %d", calls, last, encoded.Len())
+	}
+	if !bytes.Equal(decoded.Bytes(), alice) {
+		t.Errorf("original and decoded data are not equal")
+	}
+
+	// Cancel after first block
+	ctx, cancel := context.WithCancel(context.Background())
+	opts.Progress = func(done, total int64) { cancel() }
+	err = huffman.EncodeContext(ctx, bytes.NewReader(alice), ioutil.Discard, opts)
+	if err != context.Canceled {
+		t.Errorf("encoding is not canceled: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	decOpts.Progress = func(done, total int64) { cancel() }
+	err = huffman.DecodeContext(ctx, bytes.NewReader(encoded.Bytes()), ioutil.Discard, decOpts)
+	if err != context.Canceled {
+		t.Errorf("decoding is not canceled: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/corpus"
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestCorpus checks that synthetic data is reproducible, has expected entropy
+// and is encoded losslessly.
+func TestCorpus(t *testing.T) {
+	const size = 100000
+	entropy := map[corpus.Kind][2]float64{
+		corpus.Uniform:   {5.95, 6},
+		corpus.Zipf:      {5, 6.5},
+		corpus.Geometric: {2.5, 3.1},
+		corpus.Markov:    {3.5, 4.5},
+		corpus.Random:    {7.99, 8},
+	}
+
+	for _, kind := range corpus.Kinds() {
+		t.Run(string(kind), func(t *testing.T) {
+			data, err := corpus.Generate(kind, size, 1)
+			if err != nil || len(data) != size {
+				t.Fatalf("got %d bytes, %v", len(data), err)
+			}
+			again, _ := corpus.Generate(kind, size, 1)
+			other, _ := corpus.Generate(kind, size, 2)
+			if !bytes.Equal(data, again) || bytes.Equal(data, other) {
+				t.Fatalf("data does not depend on seed only")
+			}
+
+			h := helpers.Entropy(helpers.CalcFreq(bytes.NewReader(data)))
+			if want := entropy[kind]; h < want[0] || h > want[1] {
+				t.Errorf("got entropy %.3f, want between %.2f and %.2f", h, want[0], want[1])
+			}
+
+			var enc, dec bytes.Buffer
+			if err := huffman.Encode(bytes.NewReader(data), &enc); err != nil {
+				t.Fatalf("got error while encoding: %v\n", err)
+			}
+			if err := huffman.Decode(&enc, &dec); err != nil || !bytes.Equal(data, dec.Bytes()) {
+				t.Fatalf("decoding failed: %v", err)
+			}
+		})
+	}
+
+	kinds, err := corpus.ParseKinds("zipf, markov")
+	if err != nil || len(kinds) != 2 || kinds[0] != corpus.Zipf || kinds[1] != corpus.Markov {
+		t.Errorf("got kinds %v, %v", kinds, err)
+	}
+	if _, err := corpus.ParseKinds("zipf,normal"); err == nil {
+		t.Errorf("unknown kind is accepted")
+	}
+}
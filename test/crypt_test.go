@@ -0,0 +1,98 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/crypt"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestCrypt encrypts alice.txt and checks that only right secret decrypts it
+// and tampering is detected.
+func TestCrypt(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	passphrase := crypt.Secret{Passphrase: []byte("correct horse battery staple")}
+	key := crypt.Secret{Key: bytes.Repeat([]byte{7}, crypt.KeySize)}
+
+	encode := func(t *testing.T, opts huffman.Options) []byte {
+		var enc bytes.Buffer
+		if err := huffman.EncodeWith(bytes.NewReader(orig), &enc, opts); err != nil {
+			t.Fatalf("got error while encoding: %v\n", err)
+		}
+		return enc.Bytes()
+	}
+	decode := func(enc []byte, secret crypt.Secret) ([]byte, error) {
+		var dec bytes.Buffer
+		opts := huffman.DecodeOptions{Secret: secret}
+		err := huffman.DecodeContext(context.Background(), bytes.NewReader(enc), &dec, opts)
+		return dec.Bytes(), err
+	}
+
+	withPassphrase := encode(t, huffman.Options{Secret: passphrase})
+	withKey := encode(t, huffman.Options{Secret: key, Parity: 10})
+	if !bytes.HasPrefix(withPassphrase, []byte(crypt.Magic)) {
+		t.Fatal("encrypted stream has no header")
+	}
+	if bytes.Contains(withPassphrase, []byte("Alice")) {
+		t.Fatal("encrypted stream holds plain text")
+	}
+
+	tamper := func(b []byte, pos int) []byte {
+		b = append([]byte(nil), b...)
+		b[pos] ^= 1
+		return b
+	}
+
+	tests := []struct {
+		name   string
+		enc    []byte
+		secret crypt.Secret
+		err    error
+	}{
+		{"passphrase", withPassphrase, passphrase, nil},
+		{"key-and-parity", withKey, key, nil},
+		{"wrong-passphrase", withPassphrase, crypt.Secret{Passphrase: []byte("wrong")}, crypt.ErrAuth},
+		{"wrong-key", withKey, crypt.Secret{Key: make([]byte, crypt.KeySize)}, crypt.ErrAuth},
+		{"no-secret", withPassphrase, crypt.Secret{}, crypt.ErrNoKey},
+		{"tampered-data", tamper(withPassphrase, len(withPassphrase)/2), passphrase, crypt.ErrAuth},
+		{"tampered-header", tamper(withPassphrase, crypt.HeaderSize-1), passphrase, crypt.ErrAuth},
+		{"truncated", withPassphrase[:len(withPassphrase)-100], passphrase, crypt.ErrAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := decode(tt.enc, tt.secret)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v instead of %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error while decoding: %v\n", err)
+			}
+			if !bytes.Equal(orig, dec) {
+				t.Error("original and decoded data are not equal")
+			}
+		})
+	}
+
+	// Costs of key derivation are checked before it starts
+	expensive := append([]byte(nil), withPassphrase...)
+	expensive[5], expensive[6], expensive[7] = 24, 8, 255
+	if _, err := decode(expensive, passphrase); err == nil || errors.Is(err, crypt.ErrAuth) {
+		t.Errorf("got error %v for too expensive key derivation", err)
+	}
+
+	if _, err := huffman.NewReaderAt(bytes.NewReader(withPassphrase), int64(len(withPassphrase))); err == nil {
+		t.Error("random access to encrypted stream is not refused")
+	}
+}
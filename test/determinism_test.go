@@ -0,0 +1,62 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/filter"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestDeterministic encodes the same data repeatedly and checks that output is always the same.
+func TestDeterministic(t *testing.T) {
+	alice, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	// Every byte value appears equally often, so the tree is full of ties
+	ties := make([]byte, 0, 256*8)
+	for i := 0; i < 8; i++ {
+		for v := 0; v < 256; v++ {
+			ties = append(ties, byte(v*(i+1)))
+		}
+	}
+
+	inputs := map[string][]byte{"alice": alice, "ties": ties}
+	options := map[string]huffman.Options{
+		"default":     {},
+		"interleaved": {Method: huffman.MethodInterleaved},
+		"canonical":   {Header: huffman.HeaderCanonical, MaxCodeLen: 8},
+		"words":       {Words: true},
+		"arith":       {Method: huffman.MethodArithmetic},
+		"rans":        {Method: huffman.MethodRANS},
+		"auto-filter": {Filters: []filter.Filter{{Kind: filter.Auto}}},
+	}
+
+	for inName, data := range inputs {
+		for optName, opts := range options {
+			var first [sha256.Size]byte
+			for i := 0; i < 10; i++ {
+				// Concurrency must not affect output either
+				opts.Concurrency = 1 + i%4
+				opts.BlockSize = 1000
+
+				var buf bytes.Buffer
+				if err := huffman.EncodeWith(bytes.NewReader(data), &buf, opts); err != nil {
+					t.Fatalf("%s/%s: got error while encoding: %v\n", inName, optName, err)
+				}
+
+				sum := sha256.Sum256(buf.Bytes())
+				if i == 0 {
+					first = sum
+				} else if sum != first {
+					t.Errorf("%s/%s: encoding %d differs from the first one", inName, optName, i)
+					break
+				}
+			}
+		}
+	}
+}
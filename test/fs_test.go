@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bytes"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+	"github.com/cravtos/huffman/internal/pkg/huffs"
+)
+
+// TestFS checks that encoded files are served under their original names.
+func TestFS(t *testing.T) {
+	alice, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	encode := func(data []byte) []byte {
+		var buf bytes.Buffer
+		if err := huffman.EncodeWith(bytes.NewReader(data), &buf, huffman.Options{BlockSize: 4096}); err != nil {
+			t.Fatalf("got error while encoding: %v\n", err)
+		}
+		return buf.Bytes()
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"alice.txt.huf":      encode(alice),
+		"plain.txt":          []byte("plain"),
+		"sub/empty.huf":      encode(nil),
+		"sub/shadow.txt":     []byte("shadowed"),
+		"sub/shadow.txt.huf": encode([]byte("decoded")),
+	}
+	mapFS := fstest.MapFS{}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mapFS[name] = &fstest.MapFile{Data: data, Mode: 0644}
+	}
+
+	want := map[string][]byte{
+		"alice.txt":      alice,
+		"plain.txt":      []byte("plain"),
+		"sub/empty":      nil,
+		"sub/shadow.txt": []byte("decoded"),
+	}
+
+	for _, under := range []fs.FS{os.DirFS(dir), mapFS} {
+		fsys := huffs.New(under)
+
+		if err := fstest.TestFS(fsys, "alice.txt", "plain.txt", "sub/empty", "sub/shadow.txt"); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, data := range want {
+			got, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				t.Fatalf("%s: got error while reading: %v\n", name, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s: decoded file is not equal to original", name)
+			}
+
+			info, err := fs.Stat(fsys, name)
+			if err != nil {
+				t.Fatalf("%s: got error while stating: %v\n", name, err)
+			}
+			if info.Size() != int64(len(data)) {
+				t.Errorf("%s: size is %d instead of %d", name, info.Size(), len(data))
+			}
+		}
+
+		// Serve range of encoded file
+		srv := httptest.NewServer(http.FileServer(http.FS(fsys)))
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/alice.txt", nil)
+		req.Header.Set("Range", "bytes=10000-10099")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("got error while requesting: %v\n", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		srv.Close()
+		if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, alice[10000:10100]) {
+			t.Errorf("bad range response: %s", resp.Status)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/filter"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+	"github.com/icza/bitio"
+)
+
+// fuzzOptions returns options selected by fuzzer input.
+func fuzzOptions(method, mode uint8) huffman.Options {
+	opts := huffman.Options{
+		Method:    huffman.Methods()[int(method)%len(huffman.Methods())],
+		BlockSize: 1 + int(mode)*37,
+	}
+
+	switch mode % 8 {
+	case 1:
+		opts.Words = true
+	case 2:
+		opts.Width, opts.Predictor, opts.Escape = 16, huffman.PredictDelta, 4
+	case 3:
+		opts.Width, opts.BigEndian, opts.Predictor = 32, true, huffman.PredictLinear
+	case 4:
+		opts.Runs = huffman.RunsOn
+	case 5:
+		opts.Filters = []filter.Filter{{Kind: filter.Auto}}
+	case 6:
+		opts.Header, opts.MaxCodeLen, opts.Parity = huffman.HeaderCanonical, 9, 5
+	case 7:
+		opts.Checksum, opts.Sync = huffman.ChecksumCRC64, true
+	}
+	return opts
+}
+
+// fuzzSeeds returns small inputs used as seed corpus.
+func fuzzSeeds() [][]byte {
+	return [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("streets are stone stars are not"),
+		bytes.Repeat([]byte{0}, 300),
+		{0, 1, 2, 3, 255, 254, 253, 0, 0, 0, 0, 0, 1},
+	}
+}
+
+// FuzzDecode checks that decoding of arbitrary data never panics
+// and never produces more than allowed amount of data.
+func FuzzDecode(f *testing.F) {
+	for _, data := range fuzzSeeds() {
+		for mode := uint8(0); mode < 8; mode++ {
+			var buf bytes.Buffer
+			if err := huffman.EncodeWith(bytes.NewReader(data), &buf, fuzzOptions(mode, mode)); err != nil {
+				f.Fatalf("got error while encoding seed: %v\n", err)
+			}
+			f.Add(buf.Bytes())
+		}
+	}
+	for _, stream := range malformedStreams(f) {
+		f.Add(stream)
+	}
+
+	const maxOutput = 1 << 20
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		var out bytes.Buffer
+		opts := huffman.DecodeOptions{MaxOutput: maxOutput}
+		huffman.DecodeContext(context.Background(), bytes.NewReader(stream), &out, opts)
+		if out.Len() > maxOutput {
+			t.Fatalf("decoded %d bytes with limit %d", out.Len(), maxOutput)
+		}
+
+		// Blocks of random access reader are not limited, so skip large ones
+		r, err := huffman.NewReaderAt(bytes.NewReader(stream), int64(len(stream)))
+		if err != nil || r.Size() > maxOutput {
+			return
+		}
+		buf := make([]byte, 4096)
+		for off := int64(0); off < r.Size() && off < maxOutput; off += 4096 {
+			if _, err := r.ReadAt(buf, off); err != nil {
+				break
+			}
+		}
+	})
+}
+
+// FuzzRoundTrip checks that arbitrary data is decoded back unchanged with any options.
+func FuzzRoundTrip(f *testing.F) {
+	for _, data := range fuzzSeeds() {
+		for mode := uint8(0); mode < 8; mode++ {
+			f.Add(data, mode, mode)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, method, mode uint8) {
+		opts := fuzzOptions(method, mode)
+
+		var enc, dec bytes.Buffer
+		if err := huffman.EncodeWith(bytes.NewReader(data), &enc, opts); err != nil {
+			t.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+		}
+		if err := huffman.Decode(bytes.NewReader(enc.Bytes()), &dec); err != nil {
+			t.Fatalf("%+v: got error while decoding: %v\n", opts, err)
+		}
+		if !bytes.Equal(dec.Bytes(), data) {
+			t.Fatalf("%+v: original and decoded data are not equal", opts)
+		}
+
+		// Limit below size of data is reported
+		if len(data) > 1 {
+			opts := huffman.DecodeOptions{MaxOutput: int64(len(data) - 1)}
+			err := huffman.DecodeContext(context.Background(), bytes.NewReader(enc.Bytes()), ioutil.Discard, opts)
+			if err != huffman.ErrTooLarge {
+				t.Fatalf("limit below size of data: got %v", err)
+			}
+		}
+	})
+}
+
+// malformedStream returns stream of one block with Huffman header written by header.
+func malformedStream(tb testing.TB, dataSize uint32, header func(w *bitio.Writer)) []byte {
+	var block bytes.Buffer
+	w := bitio.NewWriter(&block)
+	w.TryWriteByte(byte(huffman.MethodHuffman))
+	w.TryWriteByte(0)     // No filters
+	w.TryWriteByte(0)     // Bytes alphabet
+	w.TryWriteBool(false) // No runs
+	w.TryWriteByte(byte(huffman.HeaderTree))
+	header(w)
+	if err := w.Close(); err != nil {
+		tb.Fatalf("got error while writing block: %v\n", err)
+	}
+
+	var stream bytes.Buffer
+	stream.WriteString("HUF1")
+	stream.WriteByte(byte(huffman.ChecksumNone))
+	stream.WriteByte(1)
+	binary.Write(&stream, binary.BigEndian, dataSize)
+	binary.Write(&stream, binary.BigEndian, uint32(block.Len()))
+	stream.Write(block.Bytes())
+	stream.WriteByte(0)
+	return stream.Bytes()
+}
+
+// malformedStreams returns streams with malformed trees and sizes.
+func malformedStreams(tb testing.TB) map[string][]byte {
+	return map[string][]byte{
+		// Inner node before any leaves
+		"no children": malformedStream(tb, 1, func(w *bitio.Writer) {
+			w.TryWriteBitsUnsafe(1, 32)
+			w.TryWriteBitsUnsafe(2, 32)
+			w.TryWriteBitsUnsafe(0, 1)
+			w.TryWriteBitsUnsafe(0, 1)
+		}),
+		// Inner node with a single child
+		"one child": malformedStream(tb, 1, func(w *bitio.Writer) {
+			w.TryWriteBitsUnsafe(1, 32)
+			w.TryWriteBitsUnsafe(3, 32)
+			w.TryWriteBitsUnsafe(1, 1)
+			w.TryWriteBitsUnsafe('a', 8)
+			w.TryWriteBitsUnsafe(0, 1)
+			w.TryWriteBitsUnsafe(0, 1)
+		}),
+		// More symbols in tree than the alphabet has
+		"large tree": malformedStream(tb, 1, func(w *bitio.Writer) {
+			w.TryWriteBitsUnsafe(1, 32)
+			w.TryWriteBitsUnsafe(1<<20, 32)
+		}),
+		// Symbols without tree
+		"empty tree": malformedStream(tb, 5, func(w *bitio.Writer) {
+			w.TryWriteBitsUnsafe(5, 32)
+			w.TryWriteBitsUnsafe(0, 32)
+		}),
+		// More symbols than bytes in block
+		"bomb": malformedStream(tb, 10, func(w *bitio.Writer) {
+			w.TryWriteBitsUnsafe(1<<31, 32)
+			w.TryWriteBitsUnsafe(1, 32)
+			w.TryWriteBitsUnsafe(1, 1)
+			w.TryWriteBitsUnsafe('a', 8)
+			w.TryWriteBitsUnsafe(0, 1)
+		}),
+	}
+}
+
+// TestMalformed checks that malformed trees and sizes are reported as errors.
+func TestMalformed(t *testing.T) {
+	for name, stream := range malformedStreams(t) {
+		if err := huffman.Decode(bytes.NewReader(stream), ioutil.Discard); err == nil {
+			t.Errorf("%s: malformed stream is decoded without error", name)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffhttp"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestHTTP checks that responses are compressed only when allowed
+// and that Transport decodes them transparently.
+func TestHTTP(t *testing.T) {
+	alice, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(alice)
+	})
+	mux.HandleFunc("/chunks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		for i := 0; i < len(alice); i += 100 {
+			end := i + 100
+			if end > len(alice) {
+				end = len(alice)
+			}
+			w.Write(alice[i:end])
+			if i%10000 == 0 {
+				w.(http.Flusher).Flush()
+			}
+		}
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(alice[:100])
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(alice)
+	})
+	mux.HandleFunc("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(alice)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := httptest.NewServer(huffhttp.Handler(mux, huffhttp.Config{}))
+	defer srv.Close()
+
+	tests := []struct {
+		path       string
+		compressed bool
+		want       []byte
+	}{
+		{"/text", true, alice},
+		{"/chunks", true, alice},
+		{"/small", false, alice[:100]},
+		{"/image", false, alice},
+		{"/encoded", false, alice},
+		{"/empty", false, nil},
+	}
+
+	for _, tt := range tests {
+		// Raw response as seen on the wire
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip;q=0.5, x-huffman")
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: got error while requesting: %v\n", tt.path, err)
+		}
+		raw, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: got error while reading body: %v\n", tt.path, err)
+		}
+
+		if got := resp.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s: Vary is %q", tt.path, got)
+		}
+		if tt.compressed {
+			if got := resp.Header.Get("Content-Encoding"); got != huffhttp.Encoding {
+				t.Errorf("%s: Content-Encoding is %q", tt.path, got)
+			}
+			if resp.Header.Get("Content-Length") != "" {
+				t.Errorf("%s: compressed response has Content-Length", tt.path)
+			}
+			var decoded bytes.Buffer
+			if err := huffman.Decode(bytes.NewReader(raw), &decoded); err != nil {
+				t.Fatalf("%s: got error while decoding body: %v\n", tt.path, err)
+			}
+			raw = decoded.Bytes()
+		} else if resp.Header.Get("Content-Encoding") == huffhttp.Encoding {
+			t.Errorf("%s: response is compressed", tt.path)
+		}
+		if !bytes.Equal(raw, tt.want) {
+			t.Errorf("%s: body is not equal to original", tt.path)
+		}
+
+		// Response to HEAD has the same headers
+		req.Method = http.MethodHead
+		head, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: got error while requesting: %v\n", tt.path, err)
+		}
+		head.Body.Close()
+		for _, key := range []string{"Content-Encoding", "Content-Type", "Content-Length", "Vary"} {
+			if got, want := head.Header.Get(key), resp.Header.Get(key); got != want {
+				t.Errorf("%s: %s of HEAD response is %q instead of %q", tt.path, key, got, want)
+			}
+		}
+
+		// Response decoded by Transport
+		client := &http.Client{Transport: &huffhttp.Transport{}}
+		resp, err = client.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatalf("%s: got error while requesting: %v\n", tt.path, err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: got error while reading body: %v\n", tt.path, err)
+		}
+		if tt.compressed && !resp.Uncompressed {
+			t.Errorf("%s: response is not marked as uncompressed", tt.path)
+		}
+		if !bytes.Equal(body, tt.want) {
+			t.Errorf("%s: decoded body is not equal to original", tt.path)
+		}
+	}
+
+	// Transport limits size of decoded body
+	client := &http.Client{Transport: &huffhttp.Transport{MaxOutput: 1000}}
+	resp, err := client.Get(srv.URL + "/text")
+	if err != nil {
+		t.Fatalf("got error while requesting: %v\n", err)
+	}
+	_, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.Is(err, huffman.ErrTooLarge) {
+		t.Errorf("got error %v instead of ErrTooLarge for body over MaxOutput", err)
+	}
+
+	// Clients which do not accept encoding get plain responses
+	for _, ae := range []string{"", "gzip", "x-huffman;q=0"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/text", nil)
+		req.Header.Set("Accept-Encoding", ae)
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("got error while requesting: %v\n", err)
+		}
+		resp.Body.Close()
+		if resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("Accept-Encoding %q: response is compressed", ae)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package test
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
 	"testing"
 
+	"github.com/cravtos/huffman/internal/pkg/filter"
 	"github.com/cravtos/huffman/internal/pkg/helpers"
 	"github.com/cravtos/huffman/internal/pkg/huffman"
 )
@@ -18,22 +23,222 @@ func TestHuffman(t *testing.T) {
 	}
 
 	for _, file := range testFiles {
-		file := file
-		t.Run(file.Name(), func(t *testing.T) {
-			t.Parallel()
-			equal, err := cmpEncodeAndDecode(t, "./testdata/"+file.Name())
-			if err != nil {
-				t.Errorf("got error while encoding or decoding testdata: %v\n", err)
+		// Skip fuzzing corpus and other directories
+		if file.IsDir() {
+			continue
+		}
+
+		for _, method := range huffman.Methods() {
+			for _, words := range []bool{false, true} {
+				file, opts := file, huffman.Options{Method: method, Words: words}
+				name := file.Name() + "/" + method.String()
+				if words {
+					name += "/words"
+				}
+
+				t.Run(name, func(t *testing.T) {
+					t.Parallel()
+					equal, err := cmpEncodeAndDecode(t, "./testdata/"+file.Name(), opts)
+					if err != nil {
+						t.Errorf("got error while encoding or decoding testdata: %v\n", err)
+					}
+					if equal != true {
+						t.Error("original and decoded files are not equal")
+					}
+				})
 			}
-			if equal != true {
-				t.Error("original and decoded files are not equal")
+		}
+	}
+}
+
+// TestSamples encodes and decodes synthetic 16 and 32 bit samples with every predictor.
+func TestSamples(t *testing.T) {
+	// Noisy sine wave with some spikes, plus a tail byte
+	var le16, be32 bytes.Buffer
+	for i := 0; i < 20000; i++ {
+		v := 8000*math.Sin(float64(i)/50) + float64(i*7919%13)
+		if i%997 == 0 {
+			v = -30000
+		}
+		binary.Write(&le16, binary.LittleEndian, int16(v))
+		binary.Write(&be32, binary.BigEndian, int32(v*1000))
+	}
+	le16.WriteByte(42)
+
+	tests := []struct {
+		name string
+		data []byte
+		opts huffman.Options
+	}{
+		{"le16", le16.Bytes(), huffman.Options{Width: 16}},
+		{"be32", be32.Bytes(), huffman.Options{Width: 32, BigEndian: true}},
+		{"bytes", le16.Bytes(), huffman.Options{Width: 8, Escape: 16}},
+	}
+
+	for _, tt := range tests {
+		for _, method := range huffman.Methods() {
+			for _, predictor := range []huffman.Predictor{huffman.PredictNone, huffman.PredictDelta, huffman.PredictLinear} {
+				tt, opts := tt, tt.opts
+				opts.Method, opts.Predictor = method, predictor
+
+				t.Run(tt.name+"/"+method.String()+"/"+predictor.String(), func(t *testing.T) {
+					t.Parallel()
+					var enc, dec bytes.Buffer
+					if err := huffman.EncodeWith(bytes.NewReader(tt.data), &enc, opts); err != nil {
+						t.Fatalf("got error while encoding: %v\n", err)
+					}
+					if err := huffman.Decode(&enc, &dec); err != nil {
+						t.Fatalf("got error while decoding: %v\n", err)
+					}
+					if !bytes.Equal(tt.data, dec.Bytes()) {
+						t.Error("original and decoded data are not equal")
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestFilters encodes and decodes structured records with every filter.
+func TestFilters(t *testing.T) {
+	// Records of counter, constant and x86 call
+	var data bytes.Buffer
+	for i := 0; i < 5000; i++ {
+		binary.Write(&data, binary.LittleEndian, uint32(i*3))
+		data.Write([]byte{0xE8, byte(i), 0, 0, 0, 0x90, 0x90, 0xE9})
+	}
+
+	for _, name := range []string{"delta", "stride:12", "xor:12", "bcj", "auto", "delta,xor:3,bcj"} {
+		filters, err := filter.ParseList(name)
+		if err != nil {
+			t.Fatalf("got error while parsing filters: %v\n", err)
+		}
+
+		opts := huffman.Options{Filters: filters}
+		t.Run(name, func(t *testing.T) {
+			var enc, dec bytes.Buffer
+			if err := huffman.EncodeWith(bytes.NewReader(data.Bytes()), &enc, opts); err != nil {
+				t.Fatalf("got error while encoding: %v\n", err)
+			}
+			if err := huffman.Decode(&enc, &dec); err != nil {
+				t.Fatalf("got error while decoding: %v\n", err)
+			}
+			if !bytes.Equal(data.Bytes(), dec.Bytes()) {
+				t.Error("original and decoded data are not equal")
+			}
+		})
+	}
+}
+
+// TestRuns encodes and decodes sparse data with and without collapsing runs.
+func TestRuns(t *testing.T) {
+	// Zero padded pages with a few bytes of data
+	data := make([]byte, 1<<20)
+	for i := 0; i < len(data); i += 4096 {
+		copy(data[i:], "page header")
+	}
+
+	sizes := make(map[huffman.RunMode]int)
+	for _, method := range huffman.Methods() {
+		for _, runs := range []huffman.RunMode{huffman.RunsOff, huffman.RunsOn, huffman.RunsAuto} {
+			opts := huffman.Options{Method: method, Runs: runs}
+			var enc, dec bytes.Buffer
+			if err := huffman.EncodeWith(bytes.NewReader(data), &enc, opts); err != nil {
+				t.Fatalf("%v/%v: got error while encoding: %v\n", method, runs, err)
+			}
+			sizes[runs] = enc.Len()
+
+			if err := huffman.Decode(&enc, &dec); err != nil {
+				t.Fatalf("%v/%v: got error while decoding: %v\n", method, runs, err)
+			}
+			if !bytes.Equal(data, dec.Bytes()) {
+				t.Errorf("%v/%v: original and decoded data are not equal", method, runs)
+			}
+		}
+
+		if sizes[huffman.RunsAuto] != sizes[huffman.RunsOn] || sizes[huffman.RunsOn]*2 > sizes[huffman.RunsOff] {
+			t.Errorf("%v: runs are not collapsed well: %v", method, sizes)
+		}
+	}
+}
+
+// TestRunsSmallAlphabet encodes and decodes long runs of a tiny alphabet,
+// where run symbols need more than one extra bit.
+func TestRunsSmallAlphabet(t *testing.T) {
+	inputs := map[string][]byte{
+		"zeros":  make([]byte, 1<<20),
+		"blocks": bytes.Repeat(append(bytes.Repeat([]byte("a"), 5000), bytes.Repeat([]byte("b"), 3000)...), 100),
+	}
+
+	for name, data := range inputs {
+		for _, method := range huffman.Methods() {
+			for _, runs := range []huffman.RunMode{huffman.RunsOn, huffman.RunsAuto} {
+				opts := huffman.Options{Method: method, Runs: runs, Words: true}
+				var enc, dec bytes.Buffer
+				if err := huffman.EncodeWith(bytes.NewReader(data), &enc, opts); err != nil {
+					t.Fatalf("%s %v/%v: got error while encoding: %v\n", name, method, runs, err)
+				}
+				if err := huffman.Decode(&enc, &dec); err != nil {
+					t.Fatalf("%s %v/%v: got error while decoding: %v\n", name, method, runs, err)
+				}
+				if !bytes.Equal(data, dec.Bytes()) {
+					t.Errorf("%s %v/%v: original and decoded data are not equal", name, method, runs)
+				}
+			}
+		}
+	}
+}
+
+// TestInterleavedLongCodes encodes and decodes data with codes longer than decoding table.
+func TestInterleavedLongCodes(t *testing.T) {
+	// Fibonacci frequencies give the deepest possible tree
+	var data []byte
+	a, b := 1, 1
+	for v := 0; v < 24; v++ {
+		data = append(data, bytes.Repeat([]byte{byte(v)}, a)...)
+		a, b = b, a+b
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(data), func(i, j int) { data[i], data[j] = data[j], data[i] })
+
+	for _, header := range []huffman.HeaderFormat{huffman.HeaderTree, huffman.HeaderCanonical} {
+		opts := huffman.Options{Method: huffman.MethodInterleaved, Header: header}
+		var enc, dec bytes.Buffer
+		if err := huffman.EncodeWith(bytes.NewReader(data), &enc, opts); err != nil {
+			t.Fatalf("%v: got error while encoding: %v\n", header, err)
+		}
+		if err := huffman.Decode(bytes.NewReader(enc.Bytes()), &dec); err != nil || !bytes.Equal(data, dec.Bytes()) {
+			t.Fatalf("%v: decoding failed: %v", header, err)
+		}
+	}
+}
+
+// BenchmarkDecode measures decoding throughput of alice.txt for every method.
+func BenchmarkDecode(b *testing.B) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		b.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	for _, method := range huffman.Methods() {
+		var enc bytes.Buffer
+		opts := huffman.Options{Method: method}
+		if err := huffman.EncodeWith(bytes.NewReader(orig), &enc, opts); err != nil {
+			b.Fatalf("got error while encoding testdata: %v\n", err)
+		}
+
+		b.Run(method.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(orig)))
+			for i := 0; i < b.N; i++ {
+				if err := huffman.Decode(bytes.NewReader(enc.Bytes()), ioutil.Discard); err != nil {
+					b.Fatalf("got error while decoding: %v\n", err)
+				}
 			}
 		})
 	}
 }
 
 // cmpEncodeAndDecode encodes and decodes files, and compares original to decoded one.
-func cmpEncodeAndDecode(t *testing.T, file string) (equal bool, err error) {
+func cmpEncodeAndDecode(t *testing.T, file string, opts huffman.Options) (equal bool, err error) {
 	// Create temp directory for resulting files
 	tmp := t.TempDir()
 
@@ -53,7 +258,7 @@ func cmpEncodeAndDecode(t *testing.T, file string) (equal bool, err error) {
 	defer encFile.Close()
 	defer os.Remove(encName)
 
-	err = huffman.Encode(origFile, encFile)
+	err = huffman.EncodeWith(origFile, encFile, opts)
 	if err != nil {
 		return false, err
 	}
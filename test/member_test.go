@@ -0,0 +1,145 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/crypt"
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestMembers decodes concatenated streams encoded with different options.
+func TestMembers(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+	parts := [][]byte{orig[:40000], orig[40000:40000], orig[40000:100000], orig[100000:]}
+	secret := crypt.Secret{Key: bytes.Repeat([]byte{7}, crypt.KeySize)}
+	opts := []huffman.Options{
+		{BlockSize: 16 * 1024},
+		{},
+		{BlockSize: 16 * 1024, Sync: true, Secret: secret},
+		{BlockSize: 16 * 1024, Parity: 10},
+	}
+
+	// Every member is appended to what is already encoded.
+	// Encrypted member does not end with index, so it is concatenated
+	var enc bytes.Buffer
+	for i, part := range parts {
+		err := huffman.CanAppend(bytes.NewReader(enc.Bytes()), int64(enc.Len()))
+		if i > 0 && !opts[i-1].Secret.IsZero() {
+			if err == nil {
+				t.Fatalf("appending after encrypted member is allowed")
+			}
+		} else if err != nil {
+			t.Fatalf("can't append member %d: %v", i, err)
+		}
+		if err := huffman.EncodeWith(bytes.NewReader(part), &enc, opts[i]); err != nil {
+			t.Fatalf("got error while encoding member %d: %v\n", i, err)
+		}
+	}
+
+	var dec bytes.Buffer
+	err = huffman.DecodeContext(context.Background(), bytes.NewReader(enc.Bytes()), &dec, huffman.DecodeOptions{Secret: secret})
+	if err != nil || !bytes.Equal(orig, dec.Bytes()) {
+		t.Fatalf("decoding of members failed: %v", err)
+	}
+
+	// Member with parity is the last one
+	if err := huffman.CanAppend(bytes.NewReader(enc.Bytes()), int64(enc.Len())); err == nil {
+		t.Fatalf("appending after member with parity is allowed")
+	}
+
+	// Damaged member is named
+	damaged := append([]byte(nil), enc.Bytes()...)
+	damaged[len(damaged)/3] ^= 0xff
+	err = huffman.DecodeContext(context.Background(), bytes.NewReader(damaged), ioutil.Discard, huffman.DecodeOptions{Secret: secret})
+	if err == nil || !strings.Contains(err.Error(), "member 3") {
+		t.Fatalf("damage of member is not reported: %v", err)
+	}
+
+	// Garbage after stream is not ignored
+	plain := plainMembers(t, parts)
+	if err := huffman.Decode(bytes.NewReader(append(plain, "garbage"...)), ioutil.Discard); err == nil {
+		t.Fatalf("garbage after stream is ignored")
+	}
+
+	// Random access refuses concatenated stream instead of returning wrong data
+	if _, err := huffman.NewReaderAt(bytes.NewReader(plain), int64(len(plain))); err == nil {
+		t.Fatalf("index of concatenated stream is used")
+	}
+
+	// Every member is recovered
+	var out bytes.Buffer
+	rep, err := huffman.Recover(bytes.NewReader(plain), int64(len(plain)), &out)
+	if err != nil || rep.Lost() || !bytes.Equal(orig, out.Bytes()) {
+		t.Fatalf("members are not recovered: %v %+v", err, rep)
+	}
+}
+
+// plainMembers returns concatenated streams of parts encoded with sync markers.
+func plainMembers(t *testing.T, parts [][]byte) []byte {
+	var enc bytes.Buffer
+	for _, part := range parts {
+		if err := huffman.EncodeWith(bytes.NewReader(part), &enc, huffman.Options{BlockSize: 16 * 1024, Sync: true}); err != nil {
+			t.Fatalf("got error while encoding: %v\n", err)
+		}
+	}
+	return enc.Bytes()
+}
+
+// TestAppendCommand appends streams with encode -append and checks that
+// rejected or failed appending leaves output as it was.
+func TestAppendCommand(t *testing.T) {
+	encode := buildCommand(t, "encode")
+	input, err := filepath.Abs("./testdata/alice.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := ioutil.ReadFile(input)
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+	dir := t.TempDir()
+
+	// Missing output is created, then appended to
+	for i := 0; i < 2; i++ {
+		if out, code := runCommand(t, dir, encode, "-append", "-input", input, "-output", "out.huf"); code != 0 {
+			t.Fatalf("got exit code %d\n%s", code, out)
+		}
+	}
+	enc, err := ioutil.ReadFile(filepath.Join(dir, "out.huf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec bytes.Buffer
+	if err := huffman.Decode(bytes.NewReader(enc), &dec); err != nil || !bytes.Equal(dec.Bytes(), append(orig, orig...)) {
+		t.Errorf("appended streams are not decoded: %v", err)
+	}
+
+	// File which is not a stream is refused and kept
+	junk := []byte("not a stream")
+	if err := ioutil.WriteFile(filepath.Join(dir, "junk"), junk, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, code := runCommand(t, dir, encode, "-append", "-input", input, "-output", "junk"); code != 1 {
+		t.Errorf("got exit code %d instead of 1 for output which is not a stream\n%s", code, out)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(dir, "junk")); err != nil || !bytes.Equal(got, junk) {
+		t.Errorf("refused output is changed: %v", err)
+	}
+
+	// Output created for failed appending is removed
+	if out, code := runCommand(t, dir, encode, "-append", "-input", dir, "-output", "failed.huf"); code != 1 {
+		t.Errorf("got exit code %d instead of 1 for unreadable input\n%s", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "failed.huf")); !os.IsNotExist(err) {
+		t.Errorf("output of failed appending is left: %v", err)
+	}
+}
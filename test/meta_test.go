@@ -0,0 +1,141 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestMetadata stores metadata of file in stream and restores it.
+func TestMetadata(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "alice.txt")
+	mtime := time.Date(2020, 5, 17, 12, 30, 0, 123456789, time.UTC)
+	if err := ioutil.WriteFile(name, orig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(name, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := huffman.FileMetadata(name, true, false)
+	if err != nil {
+		t.Fatalf("got error while reading metadata: %v\n", err)
+	}
+	if meta.Name != "alice.txt" || meta.Mode != 0640 || !meta.ModTime.Equal(mtime) {
+		t.Fatalf("got metadata %+v", meta)
+	}
+	meta.Xattrs = map[string][]byte{"user.origin": []byte("test"), "user.empty": {}}
+
+	for _, sync := range []bool{false, true} {
+		var enc bytes.Buffer
+		opts := huffman.Options{BlockSize: 16 * 1024, Sync: sync, Metadata: meta}
+		if err := huffman.EncodeWith(bytes.NewReader(orig), &enc, opts); err != nil {
+			t.Fatalf("got error while encoding: %v\n", err)
+		}
+
+		r, err := huffman.NewReader(bytes.NewReader(enc.Bytes()))
+		if err != nil {
+			t.Fatalf("got error while reading header: %v\n", err)
+		}
+		got := r.Metadata()
+		if got == nil || got.Name != meta.Name || got.Mode != meta.Mode || !got.HasMode ||
+			!got.ModTime.Equal(meta.ModTime) || got.HasOwner != meta.HasOwner || got.UID != meta.UID ||
+			len(got.Xattrs) != 2 || string(got.Xattrs["user.origin"]) != "test" {
+			t.Fatalf("got metadata %+v, want %+v", got, meta)
+		}
+		dec, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(orig, dec) {
+			t.Fatalf("decoding failed: %v", err)
+		}
+
+		// Blocks are found after metadata
+		ra, err := huffman.NewReaderAt(bytes.NewReader(enc.Bytes()), int64(enc.Len()))
+		if err != nil {
+			t.Fatalf("got error while reading index: %v\n", err)
+		}
+		part := make([]byte, 100)
+		if _, err := ra.ReadAt(part, 20000); err != nil || !bytes.Equal(part, orig[20000:20100]) {
+			t.Fatalf("random access failed: %v", err)
+		}
+		var out bytes.Buffer
+		rep, err := huffman.Recover(bytes.NewReader(enc.Bytes()), int64(enc.Len()), &out)
+		if err != nil || rep.Lost() || !bytes.Equal(orig, out.Bytes()) {
+			t.Fatalf("stream with metadata is not recovered: %v %+v", err, rep)
+		}
+
+		// Damaged metadata is detected
+		damaged := append([]byte(nil), enc.Bytes()...)
+		damaged[12] ^= 0xff
+		if err := huffman.Decode(bytes.NewReader(damaged), ioutil.Discard); err == nil {
+			t.Fatalf("damaged metadata is not detected")
+		}
+	}
+
+	// Mode and time are restored
+	restored := filepath.Join(dir, "restored")
+	if err := ioutil.WriteFile(restored, orig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	meta.Xattrs = nil
+	if err := meta.Apply(restored, false, false, false); err != nil {
+		t.Fatalf("got error while restoring metadata: %v\n", err)
+	}
+	info, err := os.Stat(restored)
+	if err != nil || info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+		t.Fatalf("metadata is not restored: %v %v %v", err, info.Mode(), info.ModTime())
+	}
+
+	// Setuid bit is restored only when asked
+	meta.Mode |= os.ModeSetuid
+	for _, special := range []bool{false, true} {
+		if err := meta.Apply(restored, false, false, special); err != nil {
+			t.Fatalf("got error while restoring metadata: %v\n", err)
+		}
+		info, err := os.Stat(restored)
+		if err != nil || info.Mode()&os.ModeSetuid != 0 != special || info.Mode().Perm() != 0640 {
+			t.Fatalf("special %v: got mode %v, %v", special, info.Mode(), err)
+		}
+	}
+
+	// Owner is restored only when asked
+	before, err := huffman.FileMetadata(restored, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.UID, meta.GID, meta.HasOwner = 4242, 4242, true
+	for _, owner := range []bool{false, true} {
+		if err := meta.Apply(restored, owner, false, false); err != nil {
+			t.Fatalf("got error while restoring metadata: %v\n", err)
+		}
+		after, err := huffman.FileMetadata(restored, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		changed := after.UID != before.UID || after.GID != before.GID
+		if changed != (owner && os.Getuid() == 0) {
+			t.Fatalf("owner %v: got owner %d:%d", owner, after.UID, after.GID)
+		}
+	}
+
+	// Names leaving current directory are not stored
+	for _, name := range []string{"../passwd", "/etc/passwd", "..", "a/b"} {
+		opts := huffman.Options{Metadata: &huffman.Metadata{Name: name}}
+		if err := opts.Validate(); err == nil {
+			t.Errorf("name %q is accepted", name)
+		}
+	}
+}
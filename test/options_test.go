@@ -0,0 +1,138 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+	"github.com/cravtos/huffman/internal/pkg/tree"
+)
+
+// TestOptions checks defaults and validation of options.
+func TestOptions(t *testing.T) {
+	opts, err := huffman.NewOptions(huffman.WithMethod(huffman.MethodInterleaved), huffman.WithSamples(16, false, huffman.PredictDelta))
+	if err != nil {
+		t.Fatalf("got error while making options: %v\n", err)
+	}
+	if opts.Method != huffman.MethodInterleaved || opts.BlockSize != huffman.DefaultBlockSize ||
+		opts.MaxCodeLen != huffman.DefaultMaxCodeLen || opts.Concurrency < 1 || opts.Escape != huffman.DefaultEscape {
+		t.Errorf("bad defaults: %+v", opts)
+	}
+
+	bad := [][]huffman.Option{
+		{huffman.WithBlockSize(-1)},
+		{huffman.WithMaxCodeLen(65)},
+		{huffman.WithChecksum(100)},
+		{huffman.WithHeader(100)},
+		{huffman.WithConcurrency(-1)},
+		{huffman.WithWords(), huffman.WithSamples(16, false, huffman.PredictNone)},
+	}
+	for _, options := range bad {
+		if _, err := huffman.NewOptions(options...); err == nil {
+			t.Errorf("invalid options are accepted")
+		}
+	}
+}
+
+// TestEncoderConfig encodes and decodes data with every header format, checksum and
+// several code length limits and concurrency levels.
+func TestEncoderConfig(t *testing.T) {
+	alice, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	var sizes [2]int
+	for _, header := range []huffman.HeaderFormat{huffman.HeaderTree, huffman.HeaderCanonical} {
+		for _, checksum := range []huffman.Checksum{huffman.ChecksumNone, huffman.ChecksumCRC32, huffman.ChecksumCRC64} {
+			for _, maxLen := range []int{7, 9, 0} {
+				for _, concurrency := range []int{1, 4} {
+					opts, err := huffman.NewOptions(
+						huffman.WithHeader(header),
+						huffman.WithChecksum(checksum),
+						huffman.WithMaxCodeLen(maxLen),
+						huffman.WithConcurrency(concurrency),
+						huffman.WithBlockSize(10000),
+					)
+					if err != nil {
+						t.Fatalf("got error while making options: %v\n", err)
+					}
+
+					var enc, dec bytes.Buffer
+					if err := huffman.EncodeWith(bytes.NewReader(alice), &enc, opts); err != nil {
+						t.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+					}
+					if err := huffman.Decode(bytes.NewReader(enc.Bytes()), &dec); err != nil {
+						t.Fatalf("%+v: got error while decoding: %v\n", opts, err)
+					}
+					if !bytes.Equal(dec.Bytes(), alice) {
+						t.Errorf("%+v: original and decoded data are not equal", opts)
+					}
+					if checksum == huffman.ChecksumNone && maxLen == 0 {
+						sizes[header] = enc.Len()
+					}
+				}
+			}
+		}
+	}
+
+	if sizes[huffman.HeaderCanonical] >= sizes[huffman.HeaderTree] {
+		t.Errorf("canonical header is not smaller: %d >= %d", sizes[huffman.HeaderCanonical], sizes[huffman.HeaderTree])
+	}
+
+	// Too many symbols for code length
+	opts := huffman.Options{MaxCodeLen: 3}
+	if err := huffman.EncodeWith(bytes.NewReader(alice), ioutil.Discard, opts); err == nil {
+		t.Errorf("symbols which do not fit code length are accepted")
+	}
+
+	// Damaged block is detected by checksum
+	for _, checksum := range []huffman.Checksum{huffman.ChecksumCRC32, huffman.ChecksumCRC64} {
+		var enc bytes.Buffer
+		data := bytes.Repeat([]byte("abcd"), 1000)
+		if err := huffman.EncodeWith(bytes.NewReader(data), &enc, huffman.Options{Checksum: checksum}); err != nil {
+			t.Fatalf("got error while encoding: %v\n", err)
+		}
+		damaged := enc.Bytes()
+		damaged[enc.Len()/2] ^= 0x10
+		if err := huffman.Decode(bytes.NewReader(damaged), ioutil.Discard); err == nil {
+			t.Errorf("%s: damaged stream is decoded without error", checksum)
+		}
+	}
+}
+
+// TestLimitedTree checks that code lengths are limited for skewed frequencies.
+func TestLimitedTree(t *testing.T) {
+	// Fibonacci frequencies give the deepest tree
+	freq := make(map[uint32]uint)
+	a, b := uint(1), uint(1)
+	for s := uint32(0); s < 40; s++ {
+		freq[s] = a
+		a, b = b, a+b
+	}
+
+	for _, maxLen := range []int{6, 10, 20, 39} {
+		root, err := tree.NewLimitedTree(freq, maxLen)
+		if err != nil {
+			t.Fatalf("got error while constructing tree: %v\n", err)
+		}
+		lengths := root.CodeLengths()
+		if len(lengths) != len(freq) {
+			t.Fatalf("tree has %d symbols instead of %d", len(lengths), len(freq))
+		}
+		for s, l := range lengths {
+			if int(l) > maxLen {
+				t.Errorf("code of symbol %d has length %d > %d", s, l, maxLen)
+			}
+		}
+
+		if _, err := tree.NewCanonicalTree(lengths); err != nil {
+			t.Errorf("got error while constructing canonical tree: %v", err)
+		}
+	}
+
+	if _, err := tree.NewLimitedTree(freq, 5); err == nil {
+		t.Errorf("40 symbols fit codes of 5 bits")
+	}
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/helpers"
+)
+
+// TestOutput checks that output file appears only when it is committed.
+func TestOutput(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out")
+
+	// Aborted output leaves nothing behind
+	out, err := helpers.CreateOutput(name, false)
+	if err != nil {
+		t.Fatalf("got error while creating output: %v\n", err)
+	}
+	out.WriteString("partial")
+	out.Abort()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("aborted output left %d files", len(files))
+	}
+
+	// Committed output replaces nothing until it is complete
+	out, err = helpers.CreateOutput(name, false)
+	if err != nil {
+		t.Fatalf("got error while creating output: %v\n", err)
+	}
+	out.WriteString("complete")
+	if _, err := ioutil.ReadFile(name); err == nil {
+		t.Fatalf("output exists before commit")
+	}
+	if err := out.Commit(); err != nil {
+		t.Fatalf("got error while committing output: %v\n", err)
+	}
+	out.Close()
+	if data, err := ioutil.ReadFile(name); err != nil || string(data) != "complete" {
+		t.Fatalf("got output %q, %v", data, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("committed output left %d files", len(files))
+	}
+
+	// Existing output is overwritten only when forced
+	if _, err := helpers.CreateOutput(name, false); err == nil {
+		t.Fatalf("existing output is overwritten")
+	}
+	out, err = helpers.CreateOutput(name, true)
+	if err != nil {
+		t.Fatalf("got error while creating forced output: %v\n", err)
+	}
+	out.WriteString("forced")
+	if err := out.Commit(); err != nil {
+		t.Fatalf("got error while committing output: %v\n", err)
+	}
+	out.Close()
+	if data, err := ioutil.ReadFile(name); err != nil || string(data) != "forced" {
+		t.Fatalf("got output %q, %v", data, err)
+	}
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+	"github.com/cravtos/huffman/internal/pkg/parity"
+)
+
+// TestParity corrupts encoded alice.txt with random and burst errors and checks that they are corrected.
+func TestParity(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	for _, percent := range []int{5, 10, 20} {
+		var enc bytes.Buffer
+		opts := huffman.Options{Parity: percent}
+		if err := huffman.EncodeWith(bytes.NewReader(orig), &enc, opts); err != nil {
+			t.Fatalf("got error while encoding: %v\n", err)
+		}
+
+		// Largest burst which is corrected, and number of random errors
+		// keeping every codeword correctable
+		burst := parity.Depth * parity.Symbols(percent) / 2
+		random := enc.Len() / 255
+
+		tests := []struct {
+			name    string
+			damage  func(b []byte, rnd *rand.Rand) int
+			correct bool
+		}{
+			{"intact", func(b []byte, rnd *rand.Rand) int { return 0 }, true},
+			{"random", func(b []byte, rnd *rand.Rand) int {
+				for _, i := range rnd.Perm(len(b) - parity.HeaderSize)[:random] {
+					b[parity.HeaderSize+i] ^= byte(1 + rnd.Intn(255))
+				}
+				return random
+			}, true},
+			{"burst", func(b []byte, rnd *rand.Rand) int {
+				return damageRange(b, len(b)/2, burst)
+			}, true},
+			{"header", func(b []byte, rnd *rand.Rand) int {
+				damageRange(b, 0, parity.HeaderSize/3)
+				return 0
+			}, true},
+			{"too-long-burst", func(b []byte, rnd *rand.Rand) int {
+				return damageRange(b, len(b)/2, 3*burst)
+			}, false},
+		}
+
+		for _, tt := range tests {
+			name := tt.name + "/" + strconv.Itoa(percent)
+			t.Run(name, func(t *testing.T) {
+				damaged := append([]byte(nil), enc.Bytes()...)
+				n := tt.damage(damaged, rand.New(rand.NewSource(int64(percent))))
+
+				var dec bytes.Buffer
+				corrected := -1
+				opts := huffman.DecodeOptions{Corrected: func(n int) { corrected = n }}
+				err := huffman.DecodeContext(context.Background(), bytes.NewReader(damaged), &dec, opts)
+				if !tt.correct {
+					if err == nil {
+						t.Fatal("uncorrectable errors are not detected")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("got error while decoding: %v\n", err)
+				}
+				if !bytes.Equal(orig, dec.Bytes()) {
+					t.Fatal("original and decoded data are not equal")
+				}
+				if corrected != n {
+					t.Errorf("corrected %d symbols instead of %d", corrected, n)
+				}
+
+				// Random access corrects errors too
+				ra, err := huffman.NewReaderAt(bytes.NewReader(damaged), int64(len(damaged)))
+				if err != nil {
+					t.Fatalf("got error while reading index: %v\n", err)
+				}
+				got, err := ioutil.ReadAll(io.NewSectionReader(ra, 0, ra.Size()))
+				if err != nil || !bytes.Equal(orig, got) {
+					t.Fatalf("random access failed: %v", err)
+				}
+				if ra.Corrected() != n {
+					t.Errorf("random access corrected %d symbols instead of %d", ra.Corrected(), n)
+				}
+			})
+		}
+	}
+}
+
+// damageRange inverts n bytes of b starting at pos and returns n.
+func damageRange(b []byte, pos, n int) int {
+	for i := pos; i < pos+n; i++ {
+		b[i] ^= 0xff
+	}
+	return n
+}
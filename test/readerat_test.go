@@ -0,0 +1,69 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestReaderAt reads random ranges of alice.txt encoded in small blocks.
+func TestReaderAt(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	var enc bytes.Buffer
+	opts := huffman.Options{BlockSize: 4096}
+	if err := huffman.EncodeWith(bytes.NewReader(orig), &enc, opts); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+
+	// Stream is still decodable sequentially
+	var dec bytes.Buffer
+	if err := huffman.Decode(bytes.NewReader(enc.Bytes()), &dec); err != nil {
+		t.Fatalf("got error while decoding: %v\n", err)
+	}
+	if !bytes.Equal(orig, dec.Bytes()) {
+		t.Fatal("original and decoded files are not equal")
+	}
+
+	ra, err := huffman.NewReaderAt(bytes.NewReader(enc.Bytes()), int64(enc.Len()))
+	if err != nil {
+		t.Fatalf("got error while reading index: %v\n", err)
+	}
+	if ra.Size() != int64(len(orig)) {
+		t.Fatalf("size is %d instead of %d", ra.Size(), len(orig))
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		off := rnd.Int63n(int64(len(orig)))
+		buf := make([]byte, rnd.Intn(10000))
+
+		n, err := ra.ReadAt(buf, off)
+		want := orig[off:]
+		if len(want) > len(buf) {
+			want = want[:len(buf)]
+		}
+		if n < len(buf) && err != io.EOF || n == len(buf) && err != nil {
+			t.Fatalf("ReadAt(%d, %d) returned %d, %v", len(buf), off, n, err)
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Fatalf("ReadAt(%d, %d) returned wrong data", len(buf), off)
+		}
+	}
+
+	// Seek and read the rest
+	if _, err := ra.Seek(-1000, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := ioutil.ReadAll(ra)
+	if err != nil || !bytes.Equal(tail, orig[len(orig)-1000:]) {
+		t.Errorf("reading after seek returned wrong data: %v", err)
+	}
+}
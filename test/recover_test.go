@@ -0,0 +1,131 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+)
+
+// TestRecover damages encoded alice.txt and checks that only damaged blocks are lost.
+func TestRecover(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	const blockSize = 16 * 1024
+	var enc bytes.Buffer
+	opts := huffman.Options{BlockSize: blockSize, Sync: true}
+	if err := huffman.EncodeWith(bytes.NewReader(orig), &enc, opts); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+
+	// Sync markers must not break decoding
+	var dec bytes.Buffer
+	if err := huffman.Decode(bytes.NewReader(enc.Bytes()), &dec); err != nil || !bytes.Equal(orig, dec.Bytes()) {
+		t.Fatalf("decoding failed: %v", err)
+	}
+	ra, err := huffman.NewReaderAt(bytes.NewReader(enc.Bytes()), int64(enc.Len()))
+	if err != nil {
+		t.Fatalf("got error while reading index: %v\n", err)
+	}
+	part := make([]byte, 100)
+	if _, err := ra.ReadAt(part, 3*blockSize-50); err != nil || !bytes.Equal(part, orig[3*blockSize-50:3*blockSize+50]) {
+		t.Fatalf("random access failed: %v", err)
+	}
+
+	// Intact stream is recovered completely
+	var out bytes.Buffer
+	rep, err := huffman.Recover(bytes.NewReader(enc.Bytes()), int64(enc.Len()), &out)
+	if err != nil || rep.Lost() || !bytes.Equal(orig, out.Bytes()) {
+		t.Fatalf("intact stream is not recovered: %v %+v", err, rep)
+	}
+
+	// Find positions of blocks by their sync markers
+	var blocks []int
+	for i := 0; ; i++ {
+		k := bytes.Index(enc.Bytes()[i:], []byte("\xa5HUFSYNC"))
+		if k < 0 {
+			break
+		}
+		i += k
+		blocks = append(blocks, i)
+	}
+	if len(blocks) < 6 {
+		t.Fatalf("found %d sync markers", len(blocks))
+	}
+
+	tests := []struct {
+		name      string
+		damage    func(b []byte) []byte
+		damaged   []huffman.Range
+		truncated bool
+	}{
+		{
+			name:    "byte",
+			damage:  func(b []byte) []byte { b[(blocks[3]+blocks[4])/2] ^= 0x10; return b },
+			damaged: []huffman.Range{{Offset: 3 * blockSize, Size: blockSize}},
+		},
+		{
+			name: "burst",
+			damage: func(b []byte) []byte {
+				for i := len(b) / 2; i < len(b)/2+blockSize; i++ {
+					b[i] = 0
+				}
+				return b
+			},
+		},
+		{
+			name:      "truncated",
+			damage:    func(b []byte) []byte { return b[:len(b)*2/3] },
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			damaged := tt.damage(append([]byte(nil), enc.Bytes()...))
+
+			var out bytes.Buffer
+			rep, err := huffman.Recover(bytes.NewReader(damaged), int64(len(damaged)), &out)
+			if err != nil {
+				t.Fatalf("got error while recovering: %v\n", err)
+			}
+			if !rep.Lost() || rep.Truncated != tt.truncated {
+				t.Fatalf("damage is not reported: %+v", rep)
+			}
+			if tt.damaged != nil && !equalRanges(rep.Damaged, tt.damaged) {
+				t.Errorf("got damaged ranges %v, want %v", rep.Damaged, tt.damaged)
+			}
+			if !tt.truncated && out.Len() != len(orig) {
+				t.Fatalf("recovered %d bytes instead of %d", out.Len(), len(orig))
+			}
+
+			// Everything but damaged ranges is intact
+			got, want := out.Bytes(), append([]byte(nil), orig[:out.Len()]...)
+			for _, r := range rep.Damaged {
+				for i := r.Offset; i < r.Offset+r.Size; i++ {
+					want[i] = 0
+				}
+			}
+			if !bytes.Equal(got, want) {
+				t.Error("intact data is not recovered")
+			}
+		})
+	}
+}
+
+// equalRanges reports whether ranges are the same.
+func equalRanges(a, b []huffman.Range) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
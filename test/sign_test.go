@@ -0,0 +1,121 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+	"github.com/cravtos/huffman/internal/pkg/sign"
+)
+
+// TestSign signs encoded alice.txt and checks that decoder refuses unsigned and tampered streams.
+func TestSign(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("got error while generating key: %v\n", err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	// Keys survive encoding
+	privPEM, _ := sign.MarshalPrivateKey(priv)
+	pubPEM, _ := sign.MarshalPublicKey(pub)
+	if p, err := sign.ParsePrivateKey(privPEM); err != nil || !p.Equal(priv) {
+		t.Fatalf("private key is not parsed: %v", err)
+	}
+	if p, err := sign.ParsePublicKey(pubPEM); err != nil || !p.Equal(pub) {
+		t.Fatalf("public key is not parsed: %v", err)
+	}
+
+	// Parity stream checks that trailer is stripped before parity is read
+	var enc bytes.Buffer
+	if err := huffman.EncodeWith(bytes.NewReader(orig), &enc, huffman.Options{Parity: 5}); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+	unsigned := enc.Bytes()
+	trailer, err := sign.Sign(priv, bytes.NewReader(unsigned))
+	if err != nil {
+		t.Fatalf("got error while signing: %v\n", err)
+	}
+	signed := append(append([]byte(nil), unsigned...), trailer...)
+	tampered := append([]byte(nil), signed...)
+	tampered[len(tampered)/2] ^= 1
+
+	tests := []struct {
+		name      string
+		enc       []byte
+		publicKey ed25519.PublicKey
+		detached  []byte
+		err       error
+	}{
+		{"signed", signed, pub, nil, nil},
+		{"not-checked", signed, nil, nil, nil},
+		{"detached", unsigned, pub, trailer, nil},
+		{"unsigned", unsigned, pub, nil, sign.ErrUnsigned},
+		{"other-key", signed, otherPub, nil, sign.ErrBadSignature},
+		{"tampered", tampered, pub, nil, sign.ErrBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dec bytes.Buffer
+			opts := huffman.DecodeOptions{PublicKey: tt.publicKey, Signature: tt.detached}
+			err := huffman.DecodeContext(context.Background(), bytes.NewReader(tt.enc), &dec, opts)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v instead of %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error while decoding: %v\n", err)
+			}
+			if !bytes.Equal(orig, dec.Bytes()) {
+				t.Error("original and decoded data are not equal")
+			}
+		})
+	}
+
+	// Random access skips trailer
+	ra, err := huffman.NewReaderAt(bytes.NewReader(signed), int64(len(signed)))
+	if err != nil {
+		t.Fatalf("got error while reading index: %v\n", err)
+	}
+	got, err := ioutil.ReadAll(io.NewSectionReader(ra, 0, ra.Size()))
+	if err != nil || !bytes.Equal(orig, got) {
+		t.Fatalf("random access failed: %v", err)
+	}
+
+	// Opened file is verified and then decoded from its start
+	name := filepath.Join(t.TempDir(), "signed.huf")
+	if err := ioutil.WriteFile(name, signed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := sign.VerifyOpenFile(f, "", otherPub); !errors.Is(err, sign.ErrBadSignature) {
+		t.Errorf("got error %v instead of ErrBadSignature for another key", err)
+	}
+	if err := sign.VerifyOpenFile(f, "", pub); err != nil {
+		t.Fatalf("got error while verifying opened file: %v\n", err)
+	}
+	var dec bytes.Buffer
+	if err := huffman.Decode(f, &dec); err != nil || !bytes.Equal(orig, dec.Bytes()) {
+		t.Errorf("verified file is not decoded: %v", err)
+	}
+}
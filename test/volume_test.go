@@ -0,0 +1,134 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/huffman"
+	"github.com/cravtos/huffman/internal/pkg/volume"
+)
+
+// TestVolume splits encoded alice.txt into volumes and decodes it back.
+func TestVolume(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	const size = 20 * 1000
+	base := filepath.Join(t.TempDir(), "alice.huf")
+	vw, err := volume.Create(base, size, false)
+	if err != nil {
+		t.Fatalf("got error while creating volumes: %v\n", err)
+	}
+	if err := huffman.Encode(bytes.NewReader(orig), vw); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+	if _, err := os.Stat(volume.Name(base, 1)); !os.IsNotExist(err) {
+		t.Fatalf("volume appears before set is closed: %v", err)
+	}
+	if err := vw.Close(); err != nil {
+		t.Fatalf("got error while closing volumes: %v\n", err)
+	}
+	if vw.Count() < 3 {
+		t.Fatalf("got %d volumes, want at least 3", vw.Count())
+	}
+	for i := 1; i <= vw.Count(); i++ {
+		stat, err := os.Stat(volume.Name(base, i))
+		if err != nil || stat.Size() > size {
+			t.Fatalf("bad volume %d: %v", i, err)
+		}
+	}
+
+	// Any volume may be given to open the set
+	for _, name := range []string{volume.Name(base, 1), volume.Name(base, 2)} {
+		vr, err := volume.Open(name)
+		if err != nil {
+			t.Fatalf("got error while opening %s: %v\n", name, err)
+		}
+		var dec bytes.Buffer
+		err = huffman.Decode(vr, &dec)
+		vr.Close()
+		if err != nil || !bytes.Equal(orig, dec.Bytes()) {
+			t.Fatalf("decoding of volumes failed: %v", err)
+		}
+	}
+
+	// Swapped volumes are out of order
+	second, third := volume.Name(base, 2), volume.Name(base, 3)
+	if err := os.Rename(second, base+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(third, second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := volume.Open(volume.Name(base, 1)); err == nil || !strings.Contains(err.Error(), second) || !strings.Contains(err.Error(), "out of order") {
+		t.Fatalf("swapped volumes are not detected: %v", err)
+	}
+
+	// Missing volume is named
+	if err := os.Rename(second, third); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := volume.Open(volume.Name(base, 1)); err == nil || !strings.Contains(err.Error(), second) || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("missing volume is not detected: %v", err)
+	}
+
+	// Existing volumes are not overwritten, and are kept when the set is aborted
+	other := filepath.Join(t.TempDir(), "other.huf")
+	if err := ioutil.WriteFile(volume.Name(other, 2), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vw, err = volume.Create(other, size, false)
+	if err != nil {
+		t.Fatalf("got error while creating volumes: %v\n", err)
+	}
+	if err := huffman.Encode(bytes.NewReader(orig), vw); err == nil {
+		t.Fatal("existing volume is overwritten")
+	}
+	vw.Abort()
+	if files, _ := ioutil.ReadDir(filepath.Dir(other)); len(files) != 1 {
+		t.Errorf("aborted set left %d files", len(files))
+	}
+	if data, err := ioutil.ReadFile(volume.Name(other, 2)); err != nil || string(data) != "keep" {
+		t.Errorf("existing volume is changed: %q, %v", data, err)
+	}
+}
+
+// TestParseSize checks parsing of volume sizes.
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"1000", 1000},
+		{"25M", 25e6},
+		{"2K", 2000},
+		{"1G", 1e9},
+		{"4Ki", 4096},
+		{"100Mi", 100 << 20},
+		{"1Gi", 1 << 30},
+		{"", -1},
+		{"0", -1},
+		{"-5M", -1},
+		{"M", -1},
+		{"25MB", -1},
+		{"1.5M", -1},
+	}
+	for _, tt := range tests {
+		got, err := volume.ParseSize(tt.s)
+		if tt.want < 0 {
+			if err == nil {
+				t.Errorf("ParseSize(%q) = %d, want error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/cravtos/huffman/internal/pkg/zipcodec"
+)
+
+// TestZip writes many Huffman compressed entries with archive/zip and reads them back.
+func TestZip(t *testing.T) {
+	alice, err := ioutil.ReadFile("./testdata/alice.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	// Entries of different size and content
+	rnd := rand.New(rand.NewSource(1))
+	entries := make(map[string][]byte)
+	for i := 0; i < 200; i++ {
+		var data []byte
+		switch i % 3 {
+		case 0:
+			off := rnd.Intn(len(alice))
+			data = alice[off : off+rnd.Intn(len(alice)-off)]
+		case 1:
+			data = make([]byte, rnd.Intn(5000))
+			rnd.Read(data)
+		case 2:
+			data = bytes.Repeat([]byte{byte(i)}, i)
+		}
+		entries[fmt.Sprintf("dir%d/entry%d", i%7, i)] = data
+	}
+
+	zipcodec.Register()
+	zipcodec.Register()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zipcodec.Method})
+		if err != nil {
+			t.Fatalf("%s: got error while creating entry: %v\n", name, err)
+		}
+		if _, err = w.Write(data); err != nil {
+			t.Fatalf("%s: got error while writing entry: %v\n", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("got error while closing zip: %v\n", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("got error while opening zip: %v\n", err)
+	}
+	if len(zr.File) != len(entries) {
+		t.Fatalf("zip has %d entries instead of %d", len(zr.File), len(entries))
+	}
+
+	for _, f := range zr.File {
+		if f.Method != zipcodec.Method {
+			t.Errorf("%s: method is %d", f.Name, f.Method)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("%s: got error while opening entry: %v\n", f.Name, err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: got error while reading entry: %v\n", f.Name, err)
+		}
+		if !bytes.Equal(data, entries[f.Name]) {
+			t.Errorf("%s: original and decoded entries are not equal", f.Name)
+		}
+	}
+}